@@ -0,0 +1,126 @@
+package dgraph
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"google.golang.org/grpc"
+	"strings"
+	"time"
+)
+
+// AuthEventType 认证事件类型
+type AuthEventType int
+
+const (
+	AuthLogin   AuthEventType = iota + 1 // 使用用户名密码登录
+	AuthRefresh                          // 使用 refresh token 刷新令牌
+	AuthRelogin                          // refresh token 失效后使用保存的用户名密码重新登录
+)
+
+func (t AuthEventType) String() string {
+	switch t {
+	case AuthLogin:
+		return "login"
+	case AuthRefresh:
+		return "refresh"
+	case AuthRelogin:
+		return "relogin"
+	}
+	return "unknown"
+}
+
+// AuthEvent 认证事件，Err 为空表示成功
+type AuthEvent struct {
+	Type      AuthEventType
+	Userid    string
+	Namespace uint64
+	Err       error
+}
+
+// authClient 包装 api.DgraphClient 的登录请求
+// dgo 在令牌过期时会使用 refresh token 刷新并重试一次请求，refresh token 也失效时改用保存的用户名密码登录
+type authClient struct {
+	api.DgraphClient
+	client *Client
+}
+
+func (a *authClient) Login(ctx context.Context, in *api.LoginRequest, opts ...grpc.CallOption) (*api.Response, error) {
+	d := a.client
+	if in.RefreshToken == "" {
+		resp, err := a.DgraphClient.Login(ctx, in, opts...)
+		d.emitAuth(AuthEvent{Type: AuthLogin, Userid: in.Userid, Namespace: in.Namespace, Err: err})
+		return resp, err
+	}
+	resp, err := a.DgraphClient.Login(ctx, in, opts...)
+	d.emitAuth(AuthEvent{Type: AuthRefresh, Userid: d.username, Namespace: d.namespace, Err: err})
+	if err == nil || d.username == "" || d.password == "" || errors.Is(err, ErrClientClosed) || ctx.Err() != nil {
+		return resp, err
+	}
+	relogin := &api.LoginRequest{Userid: d.username, Password: d.password, Namespace: d.namespace}
+	resp, err = a.DgraphClient.Login(ctx, relogin, opts...)
+	d.emitAuth(AuthEvent{Type: AuthRelogin, Userid: d.username, Namespace: d.namespace, Err: err})
+	return resp, err
+}
+
+func (d *Client) emitAuth(e AuthEvent) {
+	if d.authHook != nil {
+		d.authHook(e)
+	}
+}
+
+// refreshLoop 在 access token 过期前主动刷新，令牌无法解析出过期时间时退出
+func (d *Client) refreshLoop(ctx context.Context) {
+	const retryDelay = 5 * time.Second
+	for {
+		exp, ok := jwtExpiry(d.GetJwt().AccessJwt)
+		if !ok {
+			return
+		}
+		// 在剩余有效期的最后10%(至少1秒)刷新，有效期很短时至少等待一半
+		remain := time.Until(exp)
+		wait := remain - remain/10
+		if remain-wait < time.Second {
+			wait = remain - time.Second
+		}
+		if wait < remain/2 {
+			wait = remain / 2
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := d.Relogin(ctx); err != nil {
+			// 刷新失败时稍后重试，请求中的令牌过期仍由 dgo 处理
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+		}
+	}
+}
+
+// jwtExpiry 解析JWT中的 exp，不校验签名
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err = json.Unmarshal(b, &claims); err != nil || claims.Exp <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
@@ -0,0 +1,127 @@
+package dgraph
+
+import (
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// BlankNodes 为嵌套的新节点依次分配空白节点 _:t0、_:t1...，并记录对应的结构体用于写回UID
+// 零值可以直接使用，同一个变更中多次生成N-Quad时应共用一个 BlankNodes，避免空白节点重名
+// 嵌套结构体的类型名称和谓词取自 WithNestedType 指定的类型，未指定时由结构体推断
+type BlankNodes struct {
+	nodes []reflect.Value
+	seen  map[blankKey]string
+	types typeDefs
+}
+
+// blankKey 可寻址结构体的地址和类型，同一个结构体被多次引用时只创建一个节点
+type blankKey struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// node 为结构体 val 分配空白节点并转换其字段，返回空白节点和新节点的N-Quad
+func (b *BlankNodes) node(val reflect.Value) (string, []*api.NQuad, error) {
+	var key blankKey
+	if val.CanAddr() {
+		key = blankKey{addr: val.Addr().Pointer(), typ: val.Type()}
+		if name, ok := b.seen[key]; ok {
+			return name, nil, nil
+		}
+	}
+	name := fmt.Sprintf("_:t%d", len(b.nodes))
+	b.nodes = append(b.nodes, val)
+	// 先记录再转换字段，结构体之间循环引用时不会无限递归
+	if val.CanAddr() {
+		if b.seen == nil {
+			b.seen = make(map[blankKey]string)
+		}
+		b.seen[key] = name
+	}
+	typeName, fields, err := nodeTypeOf(val.Type(), b.types)
+	if err != nil {
+		return "", nil, err
+	}
+	r, err := nodeNquad(typeName, fields, name, val, b)
+	if err != nil {
+		return "", nil, err
+	}
+	if typeName != "" {
+		r = append(r, dtypeNquad(name, typeName))
+	}
+	return name, r, nil
+}
+
+// useTypes 添加嵌套结构体的类型定义，已有的定义不会被覆盖
+func (b *BlankNodes) useTypes(types typeDefs) {
+	for typ, def := range types {
+		if _, ok := b.types[typ]; ok {
+			continue
+		}
+		if b.types == nil {
+			b.types = make(typeDefs, len(types))
+		}
+		b.types[typ] = def
+	}
+}
+
+// Names 返回已分配的空白节点名称(不含 _: 前缀)，与 api.Response.Uids 的 key 一致
+func (b *BlankNodes) Names() []string {
+	r := make([]string, 0, len(b.nodes))
+	for i := range b.nodes {
+		r = append(r, fmt.Sprintf("t%d", i))
+	}
+	return r
+}
+
+// Assign 将变更返回的UID(api.Response.Uids)写回嵌套结构体的 Uid 字段
+// 不可寻址的结构体(如按值传入的数据中直接嵌套的结构体)会被跳过
+func (b *BlankNodes) Assign(uids map[string]string) {
+	for i, val := range b.nodes {
+		uid, ok := uids[fmt.Sprintf("t%d", i)]
+		if !ok {
+			continue
+		}
+		uidVal := val.FieldByName(Uid)
+		if uidVal.IsValid() && uidVal.CanSet() && uidVal.Kind() == reflect.String {
+			uidVal.SetString(uid)
+		}
+	}
+}
+
+// nodeTypeDef 嵌套结构体的类型定义
+type nodeTypeDef struct {
+	name   string
+	fields map[string]Pred
+	err    error
+}
+
+// typeDefs 由 WithNestedType 指定的嵌套结构体类型定义，key 为结构体的 reflect.Type
+type typeDefs map[reflect.Type]nodeTypeDef
+
+// inferredTypes 由结构体推断出的类型定义缓存，key 为 reflect.Type
+var inferredTypes sync.Map
+
+// nodeTypeOf 返回嵌套结构体的类型名称和谓词，优先使用 types 中指定的类型定义
+// 未指定的结构体按 TypeOf 的规则推断，类型名称为结构体名称，跳过没有 db 标签或无法转换的字段
+// 匿名结构体和泛型结构体推断出的类型名称为空
+func nodeTypeOf(typ reflect.Type, types typeDefs) (string, map[string]Pred, error) {
+	if t, ok := types[typ]; ok {
+		return t.name, t.fields, t.err
+	}
+	if v, ok := inferredTypes.Load(typ); ok {
+		t := v.(nodeTypeDef)
+		return t.name, t.fields, t.err
+	}
+	t := Type[any]{Name: typ.Name(), Fields: make(map[string]Pred)}
+	err := t.collect(typ, make(map[string]string), false)
+	if err == nil && strings.Contains(t.Name, "[") {
+		// 泛型结构体的名称包含类型参数，不能作为类型名称
+		t.Name = ""
+	}
+	inferredTypes.Store(typ, nodeTypeDef{name: t.Name, fields: t.Fields, err: err})
+	return t.Name, t.Fields, err
+}
@@ -0,0 +1,71 @@
+package dgraph_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestBlankNodeUidWriteBack(t *testing.T) {
+	client, authors, books := newLibrary(t)
+	ctx := context.Background()
+	alice := &author{Name: "Alice", Email: "alice@example.com", Books: []book{
+		{Title: "Poems", Chapters: []chapter{{Title: "Spring"}, {Title: "Autumn"}}},
+		{Title: "Essays"},
+	}}
+	if err := authors.Create(ctx, alice); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	uids := []string{alice.Uid, alice.Books[0].Uid, alice.Books[1].Uid, alice.Books[0].Chapters[0].Uid, alice.Books[0].Chapters[1].Uid}
+	seen := make(map[string]bool)
+	for i, uid := range uids {
+		if uid == "" || seen[uid] {
+			t.Fatalf("node %d: uid %q not written back: %v", i, uid, uids)
+		}
+		seen[uid] = true
+	}
+
+	// 嵌套节点使用 WithNestedType 指定的类型名称
+	resp, err := client.Txn(true).Query(ctx, "{ q(func: uid("+alice.Books[0].Uid+")) { dgraph.type book.chapters { dgraph.type } } }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r struct {
+		Q []struct {
+			Type     []string `json:"dgraph.type"`
+			Chapters []struct {
+				Type []string `json:"dgraph.type"`
+			} `json:"book.chapters"`
+		} `json:"q"`
+	}
+	if err = json.Unmarshal(resp.Json, &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Q) != 1 || len(r.Q[0].Type) != 1 || r.Q[0].Type[0] != "Book" ||
+		len(r.Q[0].Chapters) != 2 || len(r.Q[0].Chapters[0].Type) != 1 || r.Q[0].Chapters[0].Type[0] != "Chapter" {
+		t.Errorf("nested types: got %s", resp.Json)
+	}
+	poems, err := books.Get(ctx, alice.Books[0].Uid)
+	if err != nil {
+		t.Fatalf("Get nested book: %v", err)
+	}
+	if poems.Title != "Poems" || len(poems.Chapters) != 2 {
+		t.Errorf("nested book: got %+v", poems)
+	}
+
+	// Update 中的新节点同样写回UID，已有UID的节点只建立边
+	update := &author{Uid: alice.Uid, Books: []book{{Uid: alice.Books[1].Uid}, {Title: "Letters"}}}
+	if err = authors.Update(ctx, update); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if update.Books[0].Uid != alice.Books[1].Uid || update.Books[1].Uid == "" || seen[update.Books[1].Uid] {
+		t.Errorf("Update write-back: got %+v", update.Books)
+	}
+	got, err := authors.Get(ctx, alice.Uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Books) != 3 {
+		t.Errorf("Update should add one book, got %+v", got.Books)
+	}
+}
@@ -14,16 +14,25 @@ import (
 	"github.com/dgraph-io/dgo/v210"
 	"github.com/dgraph-io/dgo/v210/protos/api"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"net"
+	"sync"
+	"time"
 )
 
+// DefaultMaxMessageSize 默认的gRPC单条消息大小上限
+const DefaultMaxMessageSize = 256 << 20
+
 func NewClient(targets []string, options ...Option) (*Client, error) {
+	return NewClientContext(context.Background(), targets, options...)
+}
+
+// NewClientContext 创建客户端，ctx 用于连接建立以及ACL登录
+func NewClientContext(ctx context.Context, targets []string, options ...Option) (*Client, error) {
 	var (
-		clients    []api.DgraphClient
-		ctx        = context.Background()
+		conns      []*alpha
 		err        error
-		client     = new(Client)
+		client     = &Client{retry: DefaultRetryPolicy, maxSendMsgSize: DefaultMaxMessageSize, maxRecvMsgSize: DefaultMaxMessageSize}
 		credential = insecure.NewCredentials()
 	)
 	if len(targets) == 0 {
@@ -33,37 +42,58 @@ func NewClient(targets []string, options ...Option) (*Client, error) {
 	for _, option := range options {
 		option(client)
 	}
-	if client.servname != "" || client.certFile != "" {
-		credential, err = credentials.NewClientTLSFromFile(client.certFile, client.servname)
-		if err != nil {
-			return nil, err
-		}
+	tlsCredential, err := client.tls.credentials()
+	if err != nil {
+		return nil, err
+	}
+	if tlsCredential != nil {
+		credential = tlsCredential
 	}
 	for _, target := range targets {
 		var grpcConn = new(grpc.ClientConn)
 		var grpcOptions = []grpc.DialOption{
 			grpc.WithDefaultCallOptions(
-				grpc.MaxCallSendMsgSize(256<<20),
-				grpc.MaxCallRecvMsgSize(256<<20),
+				grpc.MaxCallSendMsgSize(client.maxSendMsgSize),
+				grpc.MaxCallRecvMsgSize(client.maxRecvMsgSize),
 			),
 			grpc.WithTransportCredentials(credential),
 		}
+		if client.dialer != nil {
+			grpcOptions = append(grpcOptions, grpc.WithContextDialer(client.dialer))
+		}
+		if len(client.interceptors) > 0 {
+			grpcOptions = append(grpcOptions, grpc.WithChainUnaryInterceptor(client.interceptors...))
+		}
+		// 自定义选项放在最后，可以覆盖默认选项
+		grpcOptions = append(grpcOptions, client.dialOptions...)
 		grpcConn, err = grpc.DialContext(ctx, target, grpcOptions...)
 		if err != nil {
+			// 释放已经建立的连接
+			for _, c := range conns {
+				_ = c.conn.Close()
+			}
 			return nil, err
 		}
-		clients = append(clients, api.NewDgraphClient(grpcConn))
+		conns = append(conns, &alpha{addr: target, conn: grpcConn, client: api.NewDgraphClient(grpcConn)})
 	}
-	if len(clients) == 0 {
+	if len(conns) == 0 {
 		err = errors.New("no dgraph targets connected")
 		return nil, err
 	}
-	client.Dgraph = dgo.NewDgraphClient(clients...)
+	client.pool = newPool(conns, client.healthInterval, client.healthTimeout)
+	client.Dgraph = dgo.NewDgraphClient(&authClient{DgraphClient: client.pool, client: client})
+	var bg context.Context
+	bg, client.cancel = context.WithCancel(context.Background())
+	if client.healthInterval > 0 {
+		client.goBackground(func() { client.pool.run(bg) })
+	}
 	if client.username != "" && client.password != "" {
-		err = client.LoginIntoNamespace(context.Background(), client.username, client.password, client.namespace)
+		err = client.LoginIntoNamespace(ctx, client.username, client.password, client.namespace)
 		if err != nil {
+			_ = client.Close()
 			return nil, err
 		}
+		client.goBackground(func() { client.refreshLoop(bg) })
 	}
 	return client, nil
 }
@@ -72,8 +102,49 @@ type Client struct {
 	*dgo.Dgraph
 	cancel             context.CancelFunc
 	username, password string
-	certFile, servname string
+	tls                tlsOptions
 	namespace          uint64
+	retry              RetryPolicy
+	dialer             func(ctx context.Context, addr string) (net.Conn, error)
+	pool               *pool
+	healthInterval     time.Duration
+	healthTimeout      time.Duration
+	authHook           func(AuthEvent)
+	dialOptions        []grpc.DialOption
+	interceptors       []grpc.UnaryClientInterceptor
+	maxSendMsgSize     int
+	maxRecvMsgSize     int
+	background         sync.WaitGroup
+	closeOnce          sync.Once
+	closeErr           error
+}
+
+// goBackground 启动后台任务，Close 会等待所有后台任务退出
+func (d *Client) goBackground(fn func()) {
+	d.background.Add(1)
+	go func() {
+		defer d.background.Done()
+		fn()
+	}()
+}
+
+// Close 停止健康检查等后台任务并关闭所有连接，之后的请求都返回 ErrClientClosed
+// 重复调用返回第一次关闭的结果
+func (d *Client) Close() error {
+	d.closeOnce.Do(func() {
+		d.pool.close()
+		if d.cancel != nil {
+			d.cancel()
+		}
+		d.background.Wait()
+		d.closeErr = d.pool.closeConns()
+	})
+	return d.closeErr
+}
+
+// Health 返回每个alpha的健康状态，未开启健康检查时所有alpha都视为健康
+func (d *Client) Health() []TargetHealth {
+	return d.pool.health()
 }
 
 func (d *Client) Txn(readOnly bool) *Txn {
@@ -84,23 +155,72 @@ func (d *Client) Txn(readOnly bool) *Txn {
 	return &Txn{Txn: d.NewTxn()}
 }
 
-func (d *Client) SetSchemaPred(pred SchemaPred) error {
-	err := d.Alter(context.Background(), &api.Operation{
+// SetSchemaPred 设置谓词结构
+func (d *Client) SetSchemaPred(ctx context.Context, pred SchemaPred) error {
+	err := d.Alter(ctx, &api.Operation{
 		Schema: pred.Rdf(),
 	})
 	return err
 }
 
-func (d *Client) SetPred(pred Pred) error {
-	err := d.Alter(context.Background(), &api.Operation{
+// SetPred 设置谓词
+func (d *Client) SetPred(ctx context.Context, pred Pred) error {
+	err := d.Alter(ctx, &api.Operation{
 		Schema: pred.Rdf(),
 	})
 	return err
 }
 
+// ApplyOption ApplySchema 的可选参数
+type ApplyOption func(o *applyOptions)
+
+type applyOptions struct {
+	background bool
+	delta      bool
+}
+
+// WithBackground 在后台构建索引，Alter 请求不等待索引构建完成
+func WithBackground() ApplyOption {
+	return func(o *applyOptions) {
+		o.background = true
+	}
+}
+
+// WithDelta 只提交与当前schema相比新增和变更的谓词与类型
+func WithDelta() ApplyOption {
+	return func(o *applyOptions) {
+		o.delta = true
+	}
+}
+
+// ApplySchema 将所有谓词和类型合并为一份schema文档，通过一次 Alter 原子地提交
+// 不会删除 s 中未包含的谓词和类型
+func (d *Client) ApplySchema(ctx context.Context, s Schema, opts ...ApplyOption) error {
+	var o applyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	rdf := s.Rdf()
+	if o.delta {
+		live, err := d.Txn(true).Schema(ctx)
+		if err != nil {
+			return err
+		}
+		rdf = live.Diff(s).Rdf()
+	}
+	if rdf == "" {
+		return nil
+	}
+	err := d.Alter(ctx, &api.Operation{
+		Schema:          rdf,
+		RunInBackground: o.background,
+	})
+	return err
+}
+
 // DropPred 删除谓词
-func (d *Client) DropPred(name string) error {
-	err := d.Alter(context.Background(), &api.Operation{
+func (d *Client) DropPred(ctx context.Context, name string) error {
+	err := d.Alter(ctx, &api.Operation{
 		DropValue: name,
 		DropOp:    api.Operation_ATTR,
 	})
@@ -108,16 +228,16 @@ func (d *Client) DropPred(name string) error {
 }
 
 // SetSchemaType 设置schema类型
-func (d *Client) SetSchemaType(t SchemaType) error {
-	err := d.Alter(context.Background(), &api.Operation{
+func (d *Client) SetSchemaType(ctx context.Context, t SchemaType) error {
+	err := d.Alter(ctx, &api.Operation{
 		Schema: t.Rdf(),
 	})
 	return err
 }
 
 // DropType 删除类型
-func (d *Client) DropType(name string) error {
-	err := d.Alter(context.Background(), &api.Operation{
+func (d *Client) DropType(ctx context.Context, name string) error {
+	err := d.Alter(ctx, &api.Operation{
 		DropValue:       name,
 		DropOp:          api.Operation_TYPE,
 		RunInBackground: false,
@@ -126,22 +246,23 @@ func (d *Client) DropType(name string) error {
 }
 
 // DropAllData 删除所有数据
-func (d *Client) DropAllData() error {
-	err := d.Alter(context.Background(), &api.Operation{
+func (d *Client) DropAllData(ctx context.Context) error {
+	err := d.Alter(ctx, &api.Operation{
 		DropOp: api.Operation_DATA,
 	})
 	return err
 }
 
 // DropAllDataAndSchema 删除所有数据和结构
-func (d *Client) DropAllDataAndSchema() error {
-	err := d.Alter(context.Background(), &api.Operation{
+func (d *Client) DropAllDataAndSchema(ctx context.Context) error {
+	err := d.Alter(ctx, &api.Operation{
 		DropAll: true,
 	})
 	return err
 }
 
-var ErrMutt = errors.New("没有数据被处理，可能不满足数据的插入约束条件")
+// ErrClientClosed 客户端已经关闭
+var ErrClientClosed = errors.New("dgraph client is closed")
 
 // CheckResponse 检查变更的返回值
 // 返回变更产生的UID列表，变更是否成功，以及是否存在错误
@@ -157,5 +278,5 @@ func CheckResponse(resp *api.Response) ([]string, error) {
 	if resp.Txn != nil && len(resp.Txn.Preds) > 0 {
 		return nil, nil
 	}
-	return nil, ErrMutt
+	return nil, ErrNoMutation
 }
@@ -0,0 +1,179 @@
+package dgraph_test
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-common/dgraph"
+	"github.com/golang-common/dgraph/dgraphtest"
+	"google.golang.org/grpc"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient 启动测试服务并通过 dgraph.NewClient 连接，测试结束时关闭客户端和服务
+func newTestClient(t *testing.T, opts ...dgraph.Option) *dgraph.Client {
+	t.Helper()
+	s := dgraphtest.NewServer()
+	t.Cleanup(s.Close)
+	opts = append([]dgraph.Option{dgraph.WithContextDialer(s.Dialer())}, opts...)
+	client, err := dgraph.NewClient([]string{dgraphtest.Target}, opts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// typeSchema 合并类型定义的谓词和类型为一份schema
+func typeSchema(types ...dgraph.TypeDef) dgraph.Schema {
+	var (
+		s    dgraph.Schema
+		seen = make(map[string]bool)
+	)
+	for _, typ := range types {
+		for _, pred := range typ.GetFields() {
+			if !seen[pred.Name] {
+				seen[pred.Name] = true
+				s.Preds = append(s.Preds, pred.Schema())
+			}
+		}
+		s.Types = append(s.Types, typ.Schema())
+	}
+	return s
+}
+
+// applyTypes 将类型定义的schema提交到服务端
+func applyTypes(t *testing.T, client *dgraph.Client, types ...dgraph.TypeDef) {
+	t.Helper()
+	if err := client.ApplySchema(context.Background(), typeSchema(types...)); err != nil {
+		t.Fatalf("ApplySchema: %v", err)
+	}
+}
+
+// alterCounter 统计 Alter 请求次数的拦截器
+func alterCounter(n *int32) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if strings.HasSuffix(method, "/Alter") {
+			atomic.AddInt32(n, 1)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func TestApplySchemaDelta(t *testing.T) {
+	var alters int32
+	client := newTestClient(t, dgraph.WithUnaryInterceptor(alterCounter(&alters)))
+	ctx := context.Background()
+	s, err := dgraph.ParseSchema(`
+name: string @index(exact) .
+age: int .
+type Person {
+	name
+	age
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.ApplySchema(ctx, s, dgraph.WithDelta()); err != nil {
+		t.Fatalf("first apply: %v", err)
+	}
+	if n := atomic.LoadInt32(&alters); n != 1 {
+		t.Fatalf("first apply: got %d alters, want 1", n)
+	}
+	// schema没有变化时不提交
+	if err = client.ApplySchema(ctx, s, dgraph.WithDelta()); err != nil {
+		t.Fatalf("unchanged apply: %v", err)
+	}
+	if n := atomic.LoadInt32(&alters); n != 1 {
+		t.Errorf("unchanged delta apply should skip Alter, got %d alters", n)
+	}
+	// 不使用 WithDelta 时总是提交
+	if err = client.ApplySchema(ctx, s); err != nil {
+		t.Fatalf("full apply: %v", err)
+	}
+	if n := atomic.LoadInt32(&alters); n != 2 {
+		t.Errorf("full apply: got %d alters, want 2", n)
+	}
+	s.Preds[1].Index, s.Preds[1].Tokens = true, []string{"int"}
+	if err = client.ApplySchema(ctx, s, dgraph.WithDelta()); err != nil {
+		t.Fatalf("delta apply: %v", err)
+	}
+	if n := atomic.LoadInt32(&alters); n != 3 {
+		t.Errorf("delta apply: got %d alters, want 3", n)
+	}
+	age, err := client.Txn(true).SchemaPred(ctx, "age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !age.Index || len(age.Tokens) != 1 || age.Tokens[0] != "int" {
+		t.Errorf("age index not applied: %+v", age)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	s := dgraphtest.NewServer()
+	defer s.Close()
+	const down = "down:9080"
+	dial := s.Dialer()
+	client, err := dgraph.NewClient([]string{dgraphtest.Target, down},
+		dgraph.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			if addr == down {
+				return nil, errors.New("connection refused")
+			}
+			return dial(ctx, addr)
+		}),
+		dgraph.WithHealthCheck(10*time.Millisecond, 100*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	var health map[string]dgraph.TargetHealth
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		health = make(map[string]dgraph.TargetHealth)
+		for _, h := range client.Health() {
+			health[h.Target] = h
+		}
+		if !health[down].Healthy && !health[dgraphtest.Target].LastCheck.IsZero() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if up := health[dgraphtest.Target]; !up.Healthy || up.Version == "" || up.LastError != nil {
+		t.Errorf("%s should be healthy: %+v", dgraphtest.Target, up)
+	}
+	if h := health[down]; h.Healthy || h.LastError == nil || h.Failures == 0 {
+		t.Errorf("%s should be unhealthy: %+v", down, h)
+	}
+	// 请求只发往健康的alpha
+	for i := 0; i < 4; i++ {
+		if _, err = client.Txn(true).Query(context.Background(), `schema{}`); err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	if _, err := client.Txn(true).Query(ctx, `schema{}`); err != nil {
+		t.Fatalf("query before close: %v", err)
+	}
+	first := client.Close()
+	if first != nil {
+		t.Fatalf("Close: %v", first)
+	}
+	if err := client.Close(); err != first {
+		t.Errorf("second Close: got %v, want %v", err, first)
+	}
+	if _, err := client.Txn(true).Query(ctx, `schema{}`); !errors.Is(err, dgraph.ErrClientClosed) {
+		t.Errorf("query after close: got %v, want %v", err, dgraph.ErrClientClosed)
+	}
+	if err := client.ApplySchema(ctx, dgraph.Schema{Preds: []dgraph.SchemaPred{{Name: "a", Type: dgraph.TypeString}}}); !errors.Is(err, dgraph.ErrClientClosed) {
+		t.Errorf("alter after close: got %v, want %v", err, dgraph.ErrClientClosed)
+	}
+}
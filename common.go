@@ -1,13 +1,13 @@
 package dgraph
 
 import (
-	"errors"
 	"fmt"
 	"github.com/dgraph-io/dgo/v210/protos/api"
 	"github.com/twpayne/go-geom"
 	"github.com/twpayne/go-geom/encoding/geojson"
 	"golang.org/x/crypto/bcrypt"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -18,6 +18,8 @@ const (
 	Uid     = "Uid"
 	StarAll = `_STAR_ALL`
 
+	CascadeDelete = "delete" // db 标签 cascade=delete，删除节点时一并删除uid谓词指向的子节点
+
 	TypeString   PredType = "string"
 	TypeDefault  PredType = "default"
 	TypePassword PredType = "password"
@@ -59,11 +61,12 @@ func (p PredType) QueryValue(data any) (string, error) {
 	}
 	if val.Kind() == reflect.Pointer {
 		val = val.Elem()
+		data = val.Interface()
 	}
 	switch p {
 	case TypeString:
 		if v, ok := data.(string); ok {
-			return fmt.Sprintf(`"%s"`, v), nil
+			return quoteString(v), nil
 		}
 	case TypeInt:
 		if v, ok := numToInt64(data); ok {
@@ -75,17 +78,17 @@ func (p PredType) QueryValue(data any) (string, error) {
 		}
 	case TypeFloat:
 		if v, ok := data.(float32); ok {
-			return fmt.Sprintf("%f", v), nil
+			return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
 		}
 		if v, ok := data.(float64); ok {
-			return fmt.Sprintf("%f", v), nil
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
 		}
 	case TypeDatetime:
 		if v, ok := data.(time.Time); ok {
-			return v.String(), nil
+			return quoteString(v.Format(time.RFC3339Nano)), nil
 		}
 	}
-	return "", fmt.Errorf("unsupport predicate type %s, datatype %s", p, reflect.TypeOf(data))
+	return "", &ConversionError{Type: p, GoType: reflect.TypeOf(data)}
 }
 
 // Value 将 data 转换为dgraph底层数据结构，用于变更请求
@@ -143,11 +146,53 @@ func (p PredType) Value(data any) (*api.Value, string, error) {
 		val := reflect.ValueOf(data)
 		subId := val.FieldByName(Uid).String()
 		if subId == "" {
-			return nil, "", errors.New("empty uid value")
+			return nil, "", &ValidationError{Field: Uid, Msg: "empty uid value"}
 		}
 		return nil, subId, nil
 	}
-	return nil, "", fmt.Errorf("error predicate type %s, datatype %s", p, reflect.TypeOf(data))
+	return nil, "", &ConversionError{Type: p, GoType: reflect.TypeOf(data)}
+}
+
+// quoteString 将字符串转义为DQL字符串字面量(含双引号)，避免用户输入破坏查询语句
+func quoteString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(&b, `\u%04x`, c)
+				continue
+			}
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// quoteStrings 转义字符串列表为DQL列表字面量
+func quoteStrings(list []string) string {
+	var r = make([]string, 0, len(list))
+	for _, s := range list {
+		r = append(r, quoteString(s))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(r, ","))
 }
 
 func numToInt64(num any) (int64, bool) {
@@ -0,0 +1,330 @@
+package dgraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config 客户端配置，可以嵌入服务自身的 json/yaml 配置文件中
+// 连接方面只限制gRPC单条消息大小，客户端对每个 target 建立一个连接并在其上复用请求，不提供连接池大小等连接数配置
+type Config struct {
+	Targets     []string          `json:"targets" yaml:"targets"`
+	TLS         TLSConfig         `json:"tls" yaml:"tls"`
+	Username    string            `json:"username" yaml:"username"`
+	Password    string            `json:"password" yaml:"password"`
+	Namespace   uint64            `json:"namespace" yaml:"namespace"`
+	DialTimeout Duration          `json:"dial_timeout" yaml:"dial_timeout"` // 建立连接和登录的超时时间，设置后以阻塞方式建立连接
+	HealthCheck HealthCheckConfig `json:"health_check" yaml:"health_check"`
+	Retry       RetryConfig       `json:"retry" yaml:"retry"`
+	MaxSendSize int               `json:"max_send_size" yaml:"max_send_size"` // 单条消息大小上限，单位字节
+	MaxRecvSize int               `json:"max_recv_size" yaml:"max_recv_size"`
+}
+
+// TLSConfig TLS配置，对应 WithTls 和 WithClientCert
+type TLSConfig struct {
+	CAFile     string `json:"ca_file" yaml:"ca_file"`
+	ServerName string `json:"server_name" yaml:"server_name"`
+	CertFile   string `json:"cert_file" yaml:"cert_file"`
+	KeyFile    string `json:"key_file" yaml:"key_file"`
+}
+
+// HealthCheckConfig 健康检查配置，Interval 为0时不开启
+type HealthCheckConfig struct {
+	Interval Duration `json:"interval" yaml:"interval"`
+	Timeout  Duration `json:"timeout" yaml:"timeout"`
+}
+
+// RetryConfig 事务冲突重试配置，为空时使用 DefaultRetryPolicy
+type RetryConfig struct {
+	MaxAttempts int      `json:"max_attempts" yaml:"max_attempts"`
+	BaseDelay   Duration `json:"base_delay" yaml:"base_delay"`
+	MaxDelay    Duration `json:"max_delay" yaml:"max_delay"`
+}
+
+// Duration 支持 "1.5s"、"100ms" 格式的时间长度，JSON中也可以使用纳秒数
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		return d.UnmarshalText([]byte(s))
+	}
+	var n int64
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	*d = Duration(n)
+	return nil
+}
+
+// ConfigError 配置错误，Field 为配置项的 json 路径、环境变量名或无法解析的配置文件路径
+type ConfigError struct {
+	Field string
+	Msg   string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid dgraph config %s: %s", e.Field, e.Msg)
+}
+
+// Validate 检查配置，返回第一个错误的 *ConfigError
+func (c Config) Validate() error {
+	if len(c.Targets) == 0 {
+		return &ConfigError{Field: "targets", Msg: "at least one target is required"}
+	}
+	for i, target := range c.Targets {
+		if strings.TrimSpace(target) == "" {
+			return &ConfigError{Field: fmt.Sprintf("targets[%d]", i), Msg: "target is empty"}
+		}
+	}
+	if c.TLS.CertFile != "" && c.TLS.KeyFile == "" {
+		return &ConfigError{Field: "tls.key_file", Msg: "required when tls.cert_file is set"}
+	}
+	if c.TLS.KeyFile != "" && c.TLS.CertFile == "" {
+		return &ConfigError{Field: "tls.cert_file", Msg: "required when tls.key_file is set"}
+	}
+	if c.Username != "" && c.Password == "" {
+		return &ConfigError{Field: "password", Msg: "required when username is set"}
+	}
+	if c.Password != "" && c.Username == "" {
+		return &ConfigError{Field: "username", Msg: "required when password is set"}
+	}
+	if c.Namespace != 0 && c.Username == "" {
+		return &ConfigError{Field: "namespace", Msg: "requires username and password"}
+	}
+	durations := []struct {
+		field string
+		val   Duration
+	}{
+		{"dial_timeout", c.DialTimeout},
+		{"health_check.interval", c.HealthCheck.Interval},
+		{"health_check.timeout", c.HealthCheck.Timeout},
+		{"retry.base_delay", c.Retry.BaseDelay},
+		{"retry.max_delay", c.Retry.MaxDelay},
+	}
+	for _, d := range durations {
+		if d.val < 0 {
+			return &ConfigError{Field: d.field, Msg: "must not be negative"}
+		}
+	}
+	if c.HealthCheck.Timeout > 0 && c.HealthCheck.Interval == 0 {
+		return &ConfigError{Field: "health_check.interval", Msg: "required when health_check.timeout is set"}
+	}
+	if c.Retry.MaxAttempts < 0 {
+		return &ConfigError{Field: "retry.max_attempts", Msg: "must not be negative"}
+	}
+	if c.Retry.MaxDelay > 0 && c.Retry.MaxDelay < c.Retry.BaseDelay {
+		return &ConfigError{Field: "retry.max_delay", Msg: "must not be less than retry.base_delay"}
+	}
+	if c.MaxSendSize < 0 {
+		return &ConfigError{Field: "max_send_size", Msg: "must not be negative"}
+	}
+	if c.MaxRecvSize < 0 {
+		return &ConfigError{Field: "max_recv_size", Msg: "must not be negative"}
+	}
+	return nil
+}
+
+// Options 将配置转换为客户端选项
+func (c Config) Options() []Option {
+	var r []Option
+	if c.TLS.CAFile != "" || c.TLS.ServerName != "" {
+		r = append(r, WithTls(c.TLS.CAFile, c.TLS.ServerName))
+	}
+	if c.TLS.CertFile != "" {
+		r = append(r, WithClientCert(c.TLS.CertFile, c.TLS.KeyFile))
+	}
+	if c.Username != "" {
+		r = append(r, WithAuth(c.Username, c.Password, c.Namespace))
+	}
+	if c.HealthCheck.Interval > 0 {
+		r = append(r, WithHealthCheck(time.Duration(c.HealthCheck.Interval), time.Duration(c.HealthCheck.Timeout)))
+	}
+	if c.Retry != (RetryConfig{}) {
+		policy := DefaultRetryPolicy
+		if c.Retry.MaxAttempts > 0 {
+			policy.MaxAttempts = c.Retry.MaxAttempts
+		}
+		if c.Retry.BaseDelay > 0 {
+			policy.BaseDelay = time.Duration(c.Retry.BaseDelay)
+		}
+		if c.Retry.MaxDelay > 0 {
+			policy.MaxDelay = time.Duration(c.Retry.MaxDelay)
+		}
+		r = append(r, WithRetryPolicy(policy))
+	}
+	if c.MaxSendSize > 0 || c.MaxRecvSize > 0 {
+		r = append(r, WithMaxMessageSize(c.MaxSendSize, c.MaxRecvSize))
+	}
+	return r
+}
+
+// NewClientFromConfig 校验配置并创建客户端，options 在配置生成的选项之后生效
+// DialTimeout 大于0时所有 target 都必须在超时前连接成功
+func NewClientFromConfig(c Config, options ...Option) (*Client, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var (
+		ctx  = context.Background()
+		opts = c.Options()
+	)
+	if c.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.DialTimeout))
+		defer cancel()
+		// 非阻塞拨号时连接在后台建立，超时只对登录生效
+		opts = append(opts, WithDialOptions(grpc.WithBlock()))
+	}
+	return NewClientContext(ctx, c.Targets, append(opts, options...)...)
+}
+
+// ConfigFromFile 从JSON配置文件读取配置，文件中不能包含未知的配置项，返回前会调用 Validate
+// yaml 标签用于将 Config 嵌入服务自身的yaml配置，yaml文件需要由服务使用yaml库解析后调用 Validate
+func ConfigFromFile(path string) (Config, error) {
+	var c Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return Config{}, &ConfigError{Field: path, Msg: "yaml files are not supported, decode them with a yaml library and call Config.Validate"}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&c); err != nil {
+		return Config{}, &ConfigError{Field: path, Msg: err.Error()}
+	}
+	if err = c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// ConfigFromEnv 从环境变量读取配置，变量名为 prefix_ 加上大写的配置路径，如 prefix 为 DGRAPH 时:
+// DGRAPH_TARGETS(逗号分隔)、DGRAPH_TLS_CA_FILE、DGRAPH_TLS_SERVER_NAME、DGRAPH_TLS_CERT_FILE、DGRAPH_TLS_KEY_FILE、
+// DGRAPH_USERNAME、DGRAPH_PASSWORD、DGRAPH_NAMESPACE、DGRAPH_DIAL_TIMEOUT、
+// DGRAPH_HEALTH_CHECK_INTERVAL、DGRAPH_HEALTH_CHECK_TIMEOUT、
+// DGRAPH_RETRY_MAX_ATTEMPTS、DGRAPH_RETRY_BASE_DELAY、DGRAPH_RETRY_MAX_DELAY、
+// DGRAPH_MAX_SEND_SIZE、DGRAPH_MAX_RECV_SIZE
+// 未设置的变量保持零值，格式错误时返回 Field 为变量名的 *ConfigError，返回前会调用 Validate
+func ConfigFromEnv(prefix string) (Config, error) {
+	var (
+		c   Config
+		env = envReader{prefix: prefix}
+	)
+	if v, ok := env.lookup("TARGETS"); ok {
+		for _, target := range strings.Split(v, ",") {
+			if target = strings.TrimSpace(target); target != "" {
+				c.Targets = append(c.Targets, target)
+			}
+		}
+	}
+	env.str("TLS_CA_FILE", &c.TLS.CAFile)
+	env.str("TLS_SERVER_NAME", &c.TLS.ServerName)
+	env.str("TLS_CERT_FILE", &c.TLS.CertFile)
+	env.str("TLS_KEY_FILE", &c.TLS.KeyFile)
+	env.str("USERNAME", &c.Username)
+	env.str("PASSWORD", &c.Password)
+	env.uint("NAMESPACE", &c.Namespace)
+	env.duration("DIAL_TIMEOUT", &c.DialTimeout)
+	env.duration("HEALTH_CHECK_INTERVAL", &c.HealthCheck.Interval)
+	env.duration("HEALTH_CHECK_TIMEOUT", &c.HealthCheck.Timeout)
+	env.int("RETRY_MAX_ATTEMPTS", &c.Retry.MaxAttempts)
+	env.duration("RETRY_BASE_DELAY", &c.Retry.BaseDelay)
+	env.duration("RETRY_MAX_DELAY", &c.Retry.MaxDelay)
+	env.int("MAX_SEND_SIZE", &c.MaxSendSize)
+	env.int("MAX_RECV_SIZE", &c.MaxRecvSize)
+	if env.err != nil {
+		return Config{}, env.err
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// envReader 读取环境变量，记录第一个解析错误
+type envReader struct {
+	prefix string
+	err    error
+}
+
+func (e *envReader) name(key string) string {
+	if e.prefix == "" {
+		return key
+	}
+	return strings.TrimSuffix(e.prefix, "_") + "_" + key
+}
+
+func (e *envReader) lookup(key string) (string, bool) {
+	v, ok := os.LookupEnv(e.name(key))
+	return strings.TrimSpace(v), ok && strings.TrimSpace(v) != ""
+}
+
+func (e *envReader) fail(key string, err error) {
+	if e.err == nil {
+		e.err = &ConfigError{Field: e.name(key), Msg: err.Error()}
+	}
+}
+
+func (e *envReader) str(key string, dst *string) {
+	if v, ok := e.lookup(key); ok {
+		*dst = v
+	}
+}
+
+func (e *envReader) int(key string, dst *int) {
+	if v, ok := e.lookup(key); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			e.fail(key, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) uint(key string, dst *uint64) {
+	if v, ok := e.lookup(key); ok {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			e.fail(key, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) duration(key string, dst *Duration) {
+	if v, ok := e.lookup(key); ok {
+		if err := dst.UnmarshalText([]byte(v)); err != nil {
+			e.fail(key, err)
+		}
+	}
+}
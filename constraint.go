@@ -0,0 +1,162 @@
+package dgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	ConstraintNotNull = "not null"
+	ConstraintUnique  = "unique"
+)
+
+var uidPattern = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+
+// ConstraintError 谓词约束冲突
+// Pred - 违反约束的谓词
+// Constraint - 约束种类，ConstraintNotNull 或 ConstraintUnique
+// Uid - 唯一约束冲突时已存在的节点UID
+type ConstraintError struct {
+	Pred       string
+	Constraint string
+	Uid        string
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Uid != "" {
+		return fmt.Sprintf("predicate %s violates %s constraint, conflict with uid %s", e.Pred, e.Constraint, e.Uid)
+	}
+	return fmt.Sprintf("predicate %s violates %s constraint", e.Pred, e.Constraint)
+}
+
+// uniqueCheck 单个唯一约束对应的查询块
+type uniqueCheck struct {
+	block string
+	pred  string
+}
+
+// CheckNotNull 检查非空约束(NotNull 和 Pri)，data 中对应字段为零值时返回 *ConstraintError
+func (t Type[T]) CheckNotNull(data any) error {
+	var err error
+	eachField(reflect.ValueOf(data), func(field reflect.StructField, val reflect.Value) bool {
+		pred, ok := t.Fields[field.Name]
+		if !ok || !(pred.NotNull || pred.Pri) {
+			return true
+		}
+		if !val.IsValid() || val.IsZero() {
+			err = &ConstraintError{Pred: pred.Name, Constraint: ConstraintNotNull}
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// upsertRequest 将 nquads 包装为变更请求，存在唯一约束(Unique 和 Pri)时生成带条件的upsert块
+// uid 为节点已存在的UID时，查询会排除节点自身；为空白节点时不排除
+// only 不为空时只检查其中的字段(key 为结构体字段名)
+// 返回的 uniqueCheck 列表用于 checkUnique 判断约束是否冲突
+func (t Type[T]) upsertRequest(uid string, data any, nquads []*api.NQuad, only map[string]bool) (*api.Request, []uniqueCheck, error) {
+	var (
+		checks []uniqueCheck
+		blocks []string
+		conds  []string
+		err    error
+		self   string
+	)
+	if !strings.HasPrefix(uid, "_:") {
+		if !uidPattern.MatchString(uid) {
+			return nil, nil, &ValidationError{Type: t.Name, Field: Uid, Msg: fmt.Sprintf("invalid uid value %s", uid)}
+		}
+		self = fmt.Sprintf(" @filter(NOT uid(%s))", uid)
+	}
+	eachField(reflect.ValueOf(data), func(field reflect.StructField, val reflect.Value) bool {
+		pred, ok := t.Fields[field.Name]
+		if !ok || !(pred.Unique || pred.Pri) || !val.IsValid() || val.IsZero() || (only != nil && !only[field.Name]) {
+			return true
+		}
+		var qval string
+		qval, err = pred.Type.QueryValue(val.Interface())
+		if err != nil {
+			err = &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Err: err}
+			return false
+		}
+		if qval == "" {
+			return true
+		}
+		n := len(checks)
+		check := uniqueCheck{block: fmt.Sprintf("c%d", n), pred: pred.Name}
+		blocks = append(blocks, fmt.Sprintf("%s(func: eq(%s, %s))%s {\n\tv%d as uid\n}", check.block, pred.funcName(), qval, self, n))
+		conds = append(conds, fmt.Sprintf("eq(len(v%d), 0)", n))
+		checks = append(checks, check)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	mu := &api.Mutation{Set: nquads}
+	if len(checks) == 0 {
+		return &api.Request{Mutations: []*api.Mutation{mu}}, nil, nil
+	}
+	mu.Cond = fmt.Sprintf("@if(%s)", strings.Join(conds, " AND "))
+	req := &api.Request{
+		Query:     fmt.Sprintf("{\n%s\n}", strings.Join(blocks, "\n")),
+		Mutations: []*api.Mutation{mu},
+	}
+	return req, checks, nil
+}
+
+// checkUnique 检查upsert块的查询结果，唯一约束冲突时返回 *ConstraintError
+func checkUnique(resp *api.Response, checks []uniqueCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+	var blocks map[string][]struct {
+		Uid string `json:"uid"`
+	}
+	if err := json.Unmarshal(resp.Json, &blocks); err != nil {
+		return err
+	}
+	for _, check := range checks {
+		if nodes := blocks[check.block]; len(nodes) > 0 {
+			return &ConstraintError{Pred: check.pred, Constraint: ConstraintUnique, Uid: nodes[0].Uid}
+		}
+	}
+	return nil
+}
+
+// eachField 遍历结构体字段(展开匿名结构体，跳过 Uid 和反向边)，指针字段会解指针
+// fn 返回 false 时停止遍历
+func eachField(val reflect.Value, fn func(field reflect.StructField, val reflect.Value) bool) bool {
+	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return true
+		}
+		val = val.Elem()
+	}
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fval := val.Field(i)
+		if field.Name == Uid || strings.HasPrefix(dbTag(field), "~") {
+			continue
+		}
+		if fval.Kind() == reflect.Pointer && !fval.IsNil() {
+			fval = fval.Elem()
+		}
+		if field.Anonymous && fval.Kind() == reflect.Struct {
+			if !eachField(fval, fn) {
+				return false
+			}
+			continue
+		}
+		if !fn(field, fval) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,401 @@
+package dgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	geomType = reflect.TypeOf((*geom.T)(nil)).Elem()
+)
+
+// dgraph 返回的 datetime 可能不带时区或只有日期
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// isNodeType 判断结构体字段类型是否对应dgraph节点(uid谓词)
+func isNodeType(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Implements(geomType) {
+		return false
+	}
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && typ != timeType
+}
+
+// nodeType 返回节点字段(去切片、去指针后)的结构体类型
+func nodeType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// facetKey 谓词 pred 上边属性 facet 在返回JSON中的键
+func facetKey(pred, facet string) string {
+	return pred + "|" + facet
+}
+
+// facetTags 收集结构体中 db 标签形如 pred|facet 的边属性名称
+func facetTags(typ reflect.Type, pred string) []string {
+	var r []string
+	prefix := pred + "|"
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		ftyp := nodeType(field.Type)
+		if field.Anonymous && ftyp.Kind() == reflect.Struct {
+			r = append(r, facetTags(ftyp, pred)...)
+			continue
+		}
+		if tag := dbTag(field); strings.HasPrefix(tag, prefix) {
+			r = append(r, strings.TrimPrefix(tag, prefix))
+		}
+	}
+	return r
+}
+
+// selection 根据结构体 db 标签生成查询块内的字段列表，uid谓词递归展开子结构体
+// fields 为结构体对应的谓词定义，用于补充 Pred.Facets 声明的边属性，可为空
+// seen 用于避免结构体循环引用导致的无限递归
+func selection(typ reflect.Type, fields map[string]Pred, seen map[reflect.Type]bool) []string {
+	var r = []string{"uid"}
+	if seen[typ] {
+		return r
+	}
+	seen[typ] = true
+	defer delete(seen, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Name == Uid {
+			continue
+		}
+		ftyp := nodeType(field.Type)
+		if field.Anonymous && ftyp.Kind() == reflect.Struct {
+			r = append(r, selection(ftyp, fields, seen)[1:]...)
+			continue
+		}
+		tag := dbTag(field)
+		if tag == "" || tag == "-" || strings.Contains(tag, "|") {
+			continue
+		}
+		// 值谓词的边属性与谓词同级，uid谓词的边属性在子节点内
+		facets := facetTags(typ, tag)
+		if isNodeType(field.Type) {
+			facets = append(facets, facetTags(ftyp, tag)...)
+		}
+		for _, f := range fields[field.Name].Facets {
+			facets = append(facets, f.Name)
+		}
+		facets = uniqueStrings(facets)
+		line := tag
+		if !isNodeType(field.Type) {
+			line = langKey(tag, fieldLang(field, fields))
+		}
+		if len(facets) > 0 {
+			line = fmt.Sprintf("%s @facets(%s)", line, strings.Join(facets, ", "))
+		}
+		if !isNodeType(field.Type) {
+			r = append(r, line)
+			continue
+		}
+		r = append(r, fmt.Sprintf("%s {\n%s\n}", line, strings.Join(selection(ftyp, nil, seen), "\n")))
+	}
+	return r
+}
+
+func uniqueStrings(list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	var (
+		r    []string
+		seen = make(map[string]bool)
+	)
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			r = append(r, s)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// Unmarshal 按结构体 db 标签解析dgraph返回的JSON
+// v 为结构体指针时解析单个节点，为结构体切片指针时解析节点列表
+func Unmarshal(data []byte, v any) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Pointer || val.IsNil() {
+		return fmt.Errorf("unmarshal target must be a non-nil pointer, got %T", v)
+	}
+	val = val.Elem()
+	if !isNodeType(val.Type()) {
+		return fmt.Errorf("unmarshal target must be a struct or struct slice, got %T", v)
+	}
+	return decodeValue(data, val, nil)
+}
+
+// UnmarshalBlock 解析查询返回JSON中 block 块的节点列表，v 为结构体切片指针
+func UnmarshalBlock(data []byte, block string, v any) error {
+	nodes, err := decodeBlock(data, block)
+	if err != nil {
+		return err
+	}
+	list, err := json.Marshal(nodes)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(list, v)
+}
+
+// decodeBlock 从查询返回的JSON中取出 block 对应的节点列表
+func decodeBlock(data []byte, block string) ([]json.RawMessage, error) {
+	var r map[string][]json.RawMessage
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return r[block], nil
+}
+
+// decodeNode 按结构体 db 标签将单个节点JSON解析到 val，val 必须可寻址
+// fields 为结构体对应的谓词定义，用于解析 Pred.Facets 声明的边属性，可为空
+func decodeNode(data json.RawMessage, val reflect.Value, fields map[string]Pred) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	return decodeFields(m, val, fields)
+}
+
+func decodeFields(m map[string]json.RawMessage, val reflect.Value, fields map[string]Pred) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fval := val.Field(i)
+		if !fval.CanSet() {
+			continue
+		}
+		if field.Name == Uid {
+			if raw, ok := m["uid"]; ok {
+				if err := json.Unmarshal(raw, fval.Addr().Interface()); err != nil {
+					return &ConversionError{Field: field.Name, Pred: "uid", Err: err}
+				}
+			}
+			continue
+		}
+		if field.Anonymous && nodeType(field.Type).Kind() == reflect.Struct {
+			if fval.Kind() == reflect.Pointer {
+				if fval.IsNil() {
+					fval.Set(reflect.New(field.Type.Elem()))
+				}
+				fval = fval.Elem()
+			}
+			if err := decodeFields(m, fval, fields); err != nil {
+				return err
+			}
+			continue
+		}
+		tag := dbTag(field)
+		if tag == "" || tag == "-" {
+			continue
+		}
+		pred := fields[field.Name]
+		lang := fieldLang(field, fields)
+		if lang == LangAll {
+			if err := decodeLangMap(m, tag, fval); err != nil {
+				return &ConversionError{Field: field.Name, Pred: tag, Type: pred.Type, GoType: field.Type, Err: err}
+			}
+			continue
+		}
+		// 带语言标签的值在结果中的键为 name@lang，兼容未指定语言查询时的结果
+		raw, ok := m[langKey(tag, lang)]
+		if !ok {
+			if raw, ok = m[tag]; !ok {
+				continue
+			}
+		}
+		if err := decodeValue(raw, fval, facetFields(tag, pred.Facets)); err != nil {
+			return &ConversionError{Field: field.Name, Pred: tag, Type: pred.Type, GoType: field.Type, Err: err}
+		}
+	}
+	return nil
+}
+
+// decodeLangMap 将谓词 pred 的所有语言值解析到 map[string]string 字段，key 为语言标签，无语言标签的值 key 为空字符串
+func decodeLangMap(m map[string]json.RawMessage, pred string, fval reflect.Value) error {
+	var r map[string]string
+	for key, raw := range m {
+		lang, ok := strings.CutPrefix(key, pred)
+		if !ok || lang != "" && !strings.HasPrefix(lang, "@") {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		if r == nil {
+			r = make(map[string]string)
+		}
+		r[strings.TrimPrefix(lang, "@")] = s
+	}
+	if r == nil {
+		return nil
+	}
+	mval := reflect.ValueOf(r).Convert(nodeType(fval.Type()))
+	if fval.Kind() == reflect.Pointer {
+		ptr := reflect.New(mval.Type())
+		ptr.Elem().Set(mval)
+		mval = ptr
+	}
+	fval.Set(mval)
+	return nil
+}
+
+// facetFields 将 Pred.Facets 转换为子节点字段名到JSON键的映射
+func facetFields(pred string, facets map[string]Facet) map[string]string {
+	if len(facets) == 0 {
+		return nil
+	}
+	var r = make(map[string]string, len(facets))
+	for field, f := range facets {
+		r[field] = facetKey(pred, f.Name)
+	}
+	return r
+}
+
+// decodeValue 将单个谓词的JSON值解析到字段，facets 为子节点边属性字段名到JSON键的映射
+func decodeValue(raw json.RawMessage, fval reflect.Value, facets map[string]string) error {
+	var (
+		list    []json.RawMessage
+		trimmed = bytes.TrimSpace(raw)
+	)
+	if bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return err
+		}
+	} else {
+		list = []json.RawMessage{raw}
+	}
+	if fval.Kind() == reflect.Slice && fval.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fval.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := decodeElem(item, slice.Index(i), facets); err != nil {
+				return err
+			}
+		}
+		fval.Set(slice)
+		return nil
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return decodeElem(list[0], fval, facets)
+}
+
+// decodeElem 解析单个值或子节点，支持指针
+func decodeElem(raw json.RawMessage, val reflect.Value, facets map[string]string) error {
+	if val.Kind() == reflect.Pointer && val.Type() != geomType && !val.Type().Implements(geomType) {
+		val.Set(reflect.New(val.Type().Elem()))
+		val = val.Elem()
+	}
+	switch {
+	case val.Type() == timeType:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		val.Set(reflect.ValueOf(t))
+		return nil
+	case val.Type() == geomType || val.Type().Implements(geomType):
+		var g geom.T
+		if err := geojson.Unmarshal(raw, &g); err != nil {
+			return err
+		}
+		gval := reflect.ValueOf(g)
+		if !gval.Type().AssignableTo(val.Type()) {
+			return fmt.Errorf("geo value %s is not assignable to %s", gval.Type(), val.Type())
+		}
+		val.Set(gval)
+		return nil
+	case val.Kind() == reflect.Struct:
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return err
+		}
+		if err := decodeFields(m, val, nil); err != nil {
+			return err
+		}
+		for name, key := range facets {
+			fval := val.FieldByName(name)
+			fraw, ok := m[key]
+			if !fval.IsValid() || !fval.CanSet() || !ok {
+				continue
+			}
+			if err := decodeValue(fraw, fval, nil); err != nil {
+				return fmt.Errorf("facet %s: %w", key, err)
+			}
+		}
+		return nil
+	}
+	return json.Unmarshal(raw, val.Addr().Interface())
+}
+
+func parseTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range timeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Decode 将查询返回JSON中 block 块的节点解析为 T 列表，边属性按 Pred.Facets 解析
+func (t Type[T]) Decode(data []byte, block string) ([]T, error) {
+	nodes, err := decodeBlock(data, block)
+	if err != nil {
+		return nil, err
+	}
+	var r = make([]T, len(nodes))
+	for i, node := range nodes {
+		if err = decodeNode(node, reflect.ValueOf(&r[i]).Elem(), t.Fields); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Selection 生成查询块内的字段列表，包括 uid、所有 db 标签谓词、反向边以及边属性
+func (t Type[T]) Selection() string {
+	typ := reflect.TypeOf(t.DataModel)
+	return strings.Join(selection(typ, t.Fields, map[reflect.Type]bool{}), "\n")
+}
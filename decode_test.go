@@ -0,0 +1,76 @@
+package dgraph_test
+
+import (
+	"context"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"reflect"
+	"testing"
+)
+
+type team struct {
+	Uid     string
+	Name    string   `db:"team.name,index=exact"`
+	Members []member `db:"team.members,reverse"`
+}
+
+type member struct {
+	Uid   string
+	Name  string `db:"member.name"`
+	Role  string `db:"team.members|role"`
+	Teams []team `db:"~team.members"`
+}
+
+func TestDecodeSelection(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	teamType := mustType[team](t, dgraph.WithTypeName("Team"))
+	memberType := mustType[member](t, dgraph.WithTypeName("Member"))
+	applyTypes(t, client, teamType, memberType)
+	resp, err := client.Txn(false).Mutate(ctx, &api.Mutation{SetNquads: []byte(`
+_:t <team.name> "Core" .
+_:t <dgraph.type> "Team" .
+_:t <team.members> _:a (role="lead") .
+_:t <team.members> _:b (role="dev") .
+_:a <member.name> "Alice" .
+_:a <dgraph.type> "Member" .
+_:b <member.name> "Bob" .
+_:b <dgraph.type> "Member" .
+`), CommitNow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uids := resp.Uids
+
+	q := "{ q(func: eq(team.name, \"Core\")) {\n" + teamType.Selection() + "\n} }"
+	r, err := client.Txn(true).Query(ctx, q)
+	if err != nil {
+		t.Fatalf("query %s: %v", q, err)
+	}
+	teams, err := teamType.Decode(r.Json, "q")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	// 嵌套节点的反向边只选择到 uid，避免循环展开
+	back := []team{{Uid: uids["t"]}}
+	want := []team{{Uid: uids["t"], Name: "Core", Members: []member{
+		{Uid: uids["a"], Name: "Alice", Role: "lead", Teams: back},
+		{Uid: uids["b"], Name: "Bob", Role: "dev", Teams: back},
+	}}}
+	if !reflect.DeepEqual(teams, want) {
+		t.Errorf("Decode: got %+v, want %+v", teams, want)
+	}
+
+	// 反向边由 ~ 标签的字段解析
+	q = "{ q(func: uid(" + uids["a"] + ")) {\n" + memberType.Selection() + "\n} }"
+	if r, err = client.Txn(true).Query(ctx, q); err != nil {
+		t.Fatalf("query %s: %v", q, err)
+	}
+	var members []member
+	if err = dgraph.UnmarshalBlock(r.Json, "q", &members); err != nil {
+		t.Fatalf("UnmarshalBlock: %v", err)
+	}
+	if len(members) != 1 || len(members[0].Teams) != 1 || members[0].Teams[0].Name != "Core" {
+		t.Errorf("reverse edge: got %+v", members)
+	}
+}
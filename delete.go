@@ -0,0 +1,234 @@
+package dgraph
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"reflect"
+	"strings"
+)
+
+// cascadeEdge 级联删除的uid谓词及其指向的结构体类型
+type cascadeEdge struct {
+	pred Pred
+	typ  reflect.Type
+}
+
+// cascadeLevel 待查询的节点及需要沿着查找子节点的级联谓词
+type cascadeLevel struct {
+	uids  []string
+	edges []cascadeEdge
+}
+
+// cascadeChild 删除边时明确给出的级联子节点
+type cascadeChild struct {
+	uid string
+	typ reflect.Type
+}
+
+// DeleteNquads 生成删除 partial 中非零值字段(指针字段为非nil)的N-Quad
+// 非列表的值谓词删除整个谓词，列表谓词只删除给出的元素，非nil的空切片删除整个谓词
+// uid谓词删除指向给出节点的边，给出的节点没有UID时(如 &Child{})删除该谓词的所有边
+// 级联删除子节点需要查询，由 Repository.Delete 和 Repository.DeleteFields 处理
+func (t Type[T]) DeleteNquads(uid string, partial T) ([]*api.NQuad, error) {
+	r, _, _, err := t.deleteNquads(uid, reflect.ValueOf(partial))
+	return r, err
+}
+
+// deleteNquads 生成删除字段的N-Quad，同时返回被删除的级联子节点，以及删除了所有边的级联谓词
+func (t Type[T]) deleteNquads(uid string, val reflect.Value) ([]*api.NQuad, []cascadeChild, []cascadeEdge, error) {
+	var (
+		r        []*api.NQuad
+		children []cascadeChild
+		all      []cascadeEdge
+		err      error
+	)
+	if uid == "" {
+		return nil, nil, nil, &ValidationError{Type: t.Name, Field: Uid, Msg: "empty uid value"}
+	}
+	eachField(val, func(field reflect.StructField, fval reflect.Value) bool {
+		pred, ok := t.Fields[field.Name]
+		// eachField 已经解指针，非nil的指针字段即使指向零值也视为给出
+		given := fval.IsValid() && (!fval.IsZero() || field.Type.Kind() == reflect.Pointer && fval.Kind() != reflect.Pointer)
+		if !ok || !given {
+			return true
+		}
+		star := &api.NQuad{Subject: uid, Predicate: pred.Name, ObjectValue: &api.Value{Val: &api.Value_DefaultVal{DefaultVal: StarAll}}}
+		if pred.Type == TypeUid {
+			var elems []reflect.Value
+			if fval.Kind() == reflect.Slice {
+				for i := 0; i < fval.Len(); i++ {
+					elems = append(elems, fval.Index(i))
+				}
+			} else {
+				elems = append(elems, fval)
+			}
+			var (
+				edge    = cascadeEdge{pred: pred, typ: nodeType(field.Type)}
+				starred = len(elems) == 0
+			)
+			for _, elem := range elems {
+				if elem.Kind() == reflect.Pointer && elem.IsNil() {
+					continue
+				}
+				child := getUid(elem.Interface())
+				if child == "" {
+					// 没有UID的节点表示删除所有边，列表中的其他元素继续处理
+					starred = true
+					continue
+				}
+				r = append(r, &api.NQuad{Subject: uid, Predicate: pred.Name, ObjectId: child})
+				if pred.Cascade == CascadeDelete {
+					children = append(children, cascadeChild{uid: child, typ: edge.typ})
+				}
+			}
+			if starred {
+				r = append(r, star)
+				if pred.Cascade == CascadeDelete {
+					all = append(all, edge)
+				}
+			}
+			return true
+		}
+		if fval.Kind() != reflect.Slice || !pred.List {
+			r = append(r, star)
+			return true
+		}
+		if fval.Len() == 0 {
+			r = append(r, star)
+			return true
+		}
+		for i := 0; i < fval.Len(); i++ {
+			var apival *api.Value
+			if apival, _, err = pred.Type.Value(fval.Index(i).Interface()); err != nil {
+				err = &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Err: err}
+				return false
+			}
+			r = append(r, &api.NQuad{Subject: uid, Predicate: pred.Name, ObjectValue: apival})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return r, children, all, nil
+}
+
+// cascadeEdges 返回结构体类型中的级联谓词，fields 为该类型的谓词定义
+func cascadeEdges(typ reflect.Type, fields map[string]Pred) []cascadeEdge {
+	var r []cascadeEdge
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		ftyp := nodeType(field.Type)
+		if field.Anonymous && dbTag(field) == "" && ftyp.Kind() == reflect.Struct {
+			r = append(r, cascadeEdges(ftyp, fields)...)
+			continue
+		}
+		if pred, ok := fields[field.Name]; ok && pred.Cascade == CascadeDelete {
+			r = append(r, cascadeEdge{pred: pred, typ: ftyp})
+		}
+	}
+	return r
+}
+
+// nestedCascadeEdges 返回嵌套结构体类型中的级联谓词，types 为 WithNestedType 指定的类型定义
+func nestedCascadeEdges(typ reflect.Type, types typeDefs) ([]cascadeEdge, error) {
+	_, fields, err := nodeTypeOf(typ, types)
+	if err != nil {
+		return nil, err
+	}
+	return cascadeEdges(typ, fields), nil
+}
+
+// cascadeNquads 逐层查询级联谓词指向的子节点，返回删除这些子节点的N-Quad
+// 只删除子节点自身的谓词，其他节点指向子节点的边需要调用方自行删除
+// seen 记录已删除的节点，避免循环引用时重复查询，types 为 WithNestedType 指定的类型定义
+func cascadeNquads(ctx context.Context, txn *Txn, pending []cascadeLevel, seen map[string]bool, types typeDefs) ([]*api.NQuad, error) {
+	var r []*api.NQuad
+	for len(pending) > 0 {
+		level := pending[0]
+		pending = pending[1:]
+		if len(level.uids) == 0 || len(level.edges) == 0 {
+			continue
+		}
+		children, err := queryChildren(ctx, txn, level.uids, level.edges)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range level.edges {
+			var fresh []string
+			for _, child := range children[edge.pred.Name] {
+				if seen[child] {
+					continue
+				}
+				seen[child] = true
+				fresh = append(fresh, child)
+				r = append(r, deleteNodeNquad(child))
+			}
+			if len(fresh) == 0 {
+				continue
+			}
+			edges, err := nestedCascadeEdges(edge.typ, types)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, cascadeLevel{uids: fresh, edges: edges})
+		}
+	}
+	return r, nil
+}
+
+// queryChildren 查询节点 uids 在谓词 edges 上指向的子节点，key 为谓词名称
+func queryChildren(ctx context.Context, txn *Txn, uids []string, edges []cascadeEdge) (map[string][]string, error) {
+	block := NewBlock("q", Uids(uids...))
+	for _, edge := range edges {
+		block.Edge(NewEdge(edge.pred).Uid())
+	}
+	q, err := NewQuery(block).Build()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := txn.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Q []map[string]json.RawMessage `json:"q"`
+	}
+	if err = json.Unmarshal(resp.Json, &res); err != nil {
+		return nil, err
+	}
+	type node struct {
+		Uid string `json:"uid"`
+	}
+	r := make(map[string][]string)
+	for _, obj := range res.Q {
+		for pred, raw := range obj {
+			var nodes []node
+			if strings.HasPrefix(strings.TrimSpace(string(raw)), "{") {
+				var n node
+				if err = json.Unmarshal(raw, &n); err != nil {
+					return nil, err
+				}
+				nodes = append(nodes, n)
+			} else if err = json.Unmarshal(raw, &nodes); err != nil {
+				return nil, err
+			}
+			for _, n := range nodes {
+				if n.Uid != "" {
+					r[pred] = append(r[pred], n.Uid)
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// deleteNodeNquad 删除节点所有谓词的N-Quad
+func deleteNodeNquad(uid string) *api.NQuad {
+	return &api.NQuad{
+		Subject:     uid,
+		Predicate:   StarAll,
+		ObjectValue: &api.Value{Val: &api.Value_DefaultVal{DefaultVal: StarAll}},
+	}
+}
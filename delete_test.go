@@ -0,0 +1,79 @@
+package dgraph_test
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-common/dgraph"
+	"testing"
+)
+
+// exists 判断节点是否还有谓词
+func exists(t *testing.T, client *dgraph.Client, uid string) bool {
+	t.Helper()
+	resp, err := client.Txn(true).Query(context.Background(), "{ q(func: uid("+uid+")) @filter(has(dgraph.type)) { uid } }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(resp.Json) != `{"q":[]}`
+}
+
+func TestCascadeDelete(t *testing.T) {
+	client, authors, books := newLibrary(t)
+	ctx := context.Background()
+	newAuthor := func(name string) *author {
+		a := &author{Name: name, Email: name + "@example.com", Tags: []string{"a", "b"}, Books: []book{
+			{Title: name + " 1", Chapters: []chapter{{Title: "one"}, {Title: "two"}}},
+			{Title: name + " 2", Chapters: []chapter{{Title: "three"}}},
+		}}
+		if err := authors.Create(ctx, a); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return a
+	}
+	alice, bob := newAuthor("Alice"), newAuthor("Bob")
+
+	if err := authors.Delete(ctx, alice.Uid); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	for _, uid := range []string{alice.Uid, alice.Books[0].Uid, alice.Books[1].Uid,
+		alice.Books[0].Chapters[0].Uid, alice.Books[0].Chapters[1].Uid, alice.Books[1].Chapters[0].Uid} {
+		if exists(t, client, uid) {
+			t.Errorf("node %s should be deleted with its author", uid)
+		}
+	}
+	if _, err := books.Get(ctx, bob.Books[0].Uid); err != nil {
+		t.Errorf("other author's book: %v", err)
+	}
+
+	// 只删除给出的子节点及其后代
+	first := bob.Books[0]
+	if err := authors.DeleteFields(ctx, bob.Uid, &author{Books: []book{{Uid: first.Uid}}, Tags: []string{"a"}}); err != nil {
+		t.Fatalf("DeleteFields: %v", err)
+	}
+	if _, err := books.Get(ctx, first.Uid); !errors.Is(err, dgraph.ErrNotFound) {
+		t.Errorf("deleted book: got %v, want %v", err, dgraph.ErrNotFound)
+	}
+	for _, c := range first.Chapters {
+		if exists(t, client, c.Uid) {
+			t.Errorf("chapter %s should be deleted with its book", c.Uid)
+		}
+	}
+	got, err := authors.Get(ctx, bob.Uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Books) != 1 || got.Books[0].Uid != bob.Books[1].Uid || len(got.Tags) != 1 || got.Tags[0] != "b" {
+		t.Errorf("DeleteFields: got %+v", got)
+	}
+
+	// 没有UID的子节点表示删除该谓词的所有边和子节点
+	if err = authors.DeleteFields(ctx, bob.Uid, &author{Books: []book{{}}}); err != nil {
+		t.Fatalf("DeleteFields all: %v", err)
+	}
+	if exists(t, client, bob.Books[1].Uid) || exists(t, client, bob.Books[1].Chapters[0].Uid) {
+		t.Error("all books and chapters should be deleted")
+	}
+	if got, err = authors.Get(ctx, bob.Uid); err != nil || len(got.Books) != 0 || got.Name != "Bob" {
+		t.Errorf("author after deleting books: %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,713 @@
+package dgraphtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 解析测试服务支持的DQL子集
+
+const (
+	tokName = iota + 1
+	tokString
+	tokPunct
+	tokRegex
+	tokLang
+)
+
+type token struct {
+	kind  int
+	val   string
+	flags string // 正则表达式的标志
+	pos   int
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.~-$+", r)
+}
+
+func isLangRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-:.*", r)
+}
+
+// tokenize 将DQL文本切分为符号
+func tokenize(src string) ([]token, error) {
+	var (
+		r     []token
+		pos   int
+		space = true
+	)
+	for pos < len(src) {
+		c, size := utf8.DecodeRuneInString(src[pos:])
+		switch {
+		case unicode.IsSpace(c):
+			pos += size
+			space = true
+			continue
+		case c == '#':
+			for pos < len(src) && src[pos] != '\n' {
+				pos++
+			}
+			space = true
+			continue
+		case c == '"':
+			end := pos + 1
+			var sb strings.Builder
+			for {
+				if end >= len(src) {
+					return nil, fmt.Errorf("unterminated string at %d", pos)
+				}
+				if src[end] == '"' {
+					break
+				}
+				if src[end] == '\\' && end+1 < len(src) {
+					end++
+					switch src[end] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					case 'r':
+						sb.WriteByte('\r')
+					case 'b':
+						sb.WriteByte('\b')
+					case 'f':
+						sb.WriteByte('\f')
+					case 'u':
+						if end+4 >= len(src) {
+							return nil, fmt.Errorf("invalid escape at %d", end)
+						}
+						n, err := strconv.ParseUint(src[end+1:end+5], 16, 32)
+						if err != nil {
+							return nil, fmt.Errorf("invalid escape at %d", end)
+						}
+						sb.WriteRune(rune(n))
+						end += 4
+					default:
+						sb.WriteByte(src[end])
+					}
+					end++
+					continue
+				}
+				sb.WriteByte(src[end])
+				end++
+			}
+			r = append(r, token{kind: tokString, val: sb.String(), pos: pos})
+			pos = end + 1
+		case c == '/':
+			end := pos + 1
+			for end < len(src) && src[end] != '/' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated regexp at %d", pos)
+			}
+			tok := token{kind: tokRegex, val: strings.ReplaceAll(src[pos+1:end], `\/`, "/"), pos: pos}
+			end++
+			start := end
+			for end < len(src) && unicode.IsLetter(rune(src[end])) {
+				end++
+			}
+			tok.flags = src[start:end]
+			r = append(r, tok)
+			pos = end
+		case c == '@' && !space && len(r) > 0 && r[len(r)-1].kind == tokName:
+			// 紧跟在谓词名后的 @ 为语言标签，如 name@en:zh:.
+			end := pos + 1
+			for end < len(src) {
+				lc, lsize := utf8.DecodeRuneInString(src[end:])
+				if !isLangRune(lc) {
+					break
+				}
+				end += lsize
+			}
+			r = append(r, token{kind: tokLang, val: src[pos+1 : end], pos: pos})
+			pos = end
+		case isNameRune(c):
+			end := pos
+			for end < len(src) {
+				nc, nsize := utf8.DecodeRuneInString(src[end:])
+				if !isNameRune(nc) {
+					break
+				}
+				end += nsize
+			}
+			r = append(r, token{kind: tokName, val: src[pos:end], pos: pos})
+			pos = end
+		case strings.ContainsRune("{}()[],:@=<>!*", c):
+			r = append(r, token{kind: tokPunct, val: string(c), pos: pos})
+			pos += size
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", c, pos)
+		}
+		space = false
+	}
+	return r, nil
+}
+
+// arg 函数参数
+type arg struct {
+	kind  int // tokName、tokString、tokRegex，列表和函数调用分别使用 list、call
+	val   string
+	flags string
+	lang  string // 谓词参数的语言标签，如 name@en
+	list  []arg
+	call  *funcCall
+}
+
+type funcCall struct {
+	name string
+	args []arg
+}
+
+// filterExpr 过滤表达式，op 为 and、or、not 或 fn
+type filterExpr struct {
+	op   string
+	kids []*filterExpr
+	fn   *funcCall
+}
+
+// field 查询块中的字段或嵌套边
+type field struct {
+	name     string   // 谓词名称、uid、expand(_all_)、count(pred)
+	alias    string   // 输出时使用的键
+	varName  string   // x as ...
+	langs    []string // 语言标签列表
+	allLangs bool     // name@*
+	facets   []string
+	facetAll bool
+	hasFacet bool
+	filter   *filterExpr
+	params   map[string]string
+	children []*field
+	isEdge   bool
+}
+
+// block 根查询块
+type block struct {
+	field
+	root *funcCall
+	// schema 查询
+	schema      bool
+	schemaPreds []string
+	schemaTypes []string
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	vars map[string]string
+}
+
+func (p *parser) peek(n int) token {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return token{}
+}
+
+func (p *parser) is(kind int, val string) bool {
+	t := p.peek(0)
+	return t.kind == kind && t.val == val
+}
+
+func (p *parser) next() token {
+	t := p.peek(0)
+	p.pos++
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	t := p.peek(0)
+	return fmt.Errorf("dql: %s at offset %d (near %q)", fmt.Sprintf(format, args...), t.pos, t.val)
+}
+
+func (p *parser) expect(kind int, val string) error {
+	if !p.is(kind, val) {
+		return p.errorf("expected %q", val)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t := p.peek(0)
+	if t.kind != tokName {
+		return "", p.errorf("expected name")
+	}
+	p.pos++
+	return t.val, nil
+}
+
+// parseQuery 解析完整的查询文本，vars 为请求携带的变量
+func parseQuery(src string, vars map[string]string) ([]*block, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, vars: make(map[string]string)}
+	for k, v := range vars {
+		p.vars[k] = v
+	}
+	// schema 查询不需要外层大括号
+	if p.is(tokName, "schema") {
+		b, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		return []*block{b}, nil
+	}
+	if p.is(tokName, "query") {
+		p.next()
+		if p.peek(0).kind == tokName {
+			p.next()
+		}
+		if p.is(tokPunct, "(") {
+			if err = p.parseVarDefs(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = p.expect(tokPunct, "{"); err != nil {
+		return nil, err
+	}
+	var blocks []*block
+	for !p.is(tokPunct, "}") {
+		if p.peek(0).kind == 0 {
+			return nil, p.errorf("unexpected end of query")
+		}
+		b, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	p.next()
+	return blocks, nil
+}
+
+// parseVarDefs 解析 ($a: string = "x", $b: int)，未传入的变量使用默认值
+func (p *parser) parseVarDefs() error {
+	p.next()
+	for !p.is(tokPunct, ")") {
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err = p.expect(tokPunct, ":"); err != nil {
+			return err
+		}
+		if _, err = p.name(); err != nil {
+			return err
+		}
+		if p.is(tokPunct, "!") {
+			p.next()
+		}
+		if p.is(tokPunct, "=") {
+			p.next()
+			def := p.next()
+			if _, ok := p.vars[name]; !ok {
+				p.vars[name] = def.val
+			}
+		}
+		if p.is(tokPunct, ",") {
+			p.next()
+		}
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseBlock() (*block, error) {
+	var b = &block{}
+	if p.peek(0).kind == tokName && p.peek(1).kind == tokName && p.peek(1).val == "as" {
+		b.varName = p.next().val
+		p.next()
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	b.name = name
+	b.alias = name
+	if name == "schema" {
+		return b, p.parseSchemaBlock(b)
+	}
+	if err = p.expect(tokPunct, "("); err != nil {
+		return nil, err
+	}
+	b.params = make(map[string]string)
+	for !p.is(tokPunct, ")") {
+		key, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(tokPunct, ":"); err != nil {
+			return nil, err
+		}
+		if key == "func" {
+			if b.root, err = p.parseFunc(); err != nil {
+				return nil, err
+			}
+		} else {
+			t := p.next()
+			b.params[key] = p.resolve(t.val)
+		}
+		if p.is(tokPunct, ",") {
+			p.next()
+		}
+	}
+	p.next()
+	if b.root == nil {
+		return nil, p.errorf("block %s has no root function", name)
+	}
+	if err = p.parseDirectives(&b.field); err != nil {
+		return nil, err
+	}
+	b.children, err = p.parseFields()
+	return b, err
+}
+
+// parseSchemaBlock 解析 schema(pred: [a, b], type: T) { ... }
+func (p *parser) parseSchemaBlock(b *block) error {
+	b.schema = true
+	if p.is(tokPunct, "(") {
+		p.next()
+		for !p.is(tokPunct, ")") {
+			key, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err = p.expect(tokPunct, ":"); err != nil {
+				return err
+			}
+			var names []string
+			if p.is(tokPunct, "[") {
+				p.next()
+				for !p.is(tokPunct, "]") {
+					n, err := p.name()
+					if err != nil {
+						return err
+					}
+					names = append(names, n)
+					if p.is(tokPunct, ",") {
+						p.next()
+					}
+				}
+				p.next()
+			} else {
+				n, err := p.name()
+				if err != nil {
+					return err
+				}
+				names = append(names, n)
+			}
+			switch key {
+			case "pred":
+				b.schemaPreds = append(b.schemaPreds, names...)
+			case "type":
+				b.schemaTypes = append(b.schemaTypes, names...)
+			default:
+				return p.errorf("unknown schema argument %s", key)
+			}
+			if p.is(tokPunct, ",") {
+				p.next()
+			}
+		}
+		p.next()
+	}
+	// 忽略 schema 块内的字段列表
+	if err := p.expect(tokPunct, "{"); err != nil {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		t := p.next()
+		switch {
+		case t.kind == 0:
+			return p.errorf("unexpected end of schema block")
+		case t.kind == tokPunct && t.val == "{":
+			depth++
+		case t.kind == tokPunct && t.val == "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+// parseDirectives 解析 @filter、@facets 以及被忽略的其他指令
+func (p *parser) parseDirectives(f *field) error {
+	for p.is(tokPunct, "@") {
+		p.next()
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "filter":
+			if err = p.expect(tokPunct, "("); err != nil {
+				return err
+			}
+			if f.filter, err = p.parseFilter(); err != nil {
+				return err
+			}
+			if err = p.expect(tokPunct, ")"); err != nil {
+				return err
+			}
+		case "facets":
+			f.hasFacet = true
+			if !p.is(tokPunct, "(") {
+				f.facetAll = true
+				continue
+			}
+			p.next()
+			for !p.is(tokPunct, ")") {
+				n, err := p.name()
+				if err != nil {
+					return err
+				}
+				f.facets = append(f.facets, n)
+				if p.is(tokPunct, ",") {
+					p.next()
+				}
+			}
+			p.next()
+		default:
+			return p.errorf("unsupported directive @%s", name)
+		}
+	}
+	return nil
+}
+
+// parseFields 解析 { field ... }，没有大括号时返回空
+func (p *parser) parseFields() ([]*field, error) {
+	if !p.is(tokPunct, "{") {
+		return nil, nil
+	}
+	p.next()
+	var r []*field
+	for !p.is(tokPunct, "}") {
+		if p.peek(0).kind == 0 {
+			return nil, p.errorf("unexpected end of block")
+		}
+		f, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, f)
+	}
+	p.next()
+	return r, nil
+}
+
+func (p *parser) parseField() (*field, error) {
+	var f = &field{params: make(map[string]string)}
+	if p.peek(0).kind == tokName && p.peek(1).kind == tokPunct && p.peek(1).val == ":" {
+		f.alias = p.next().val
+		p.next()
+	}
+	if p.peek(0).kind == tokName && p.peek(1).kind == tokName && p.peek(1).val == "as" {
+		f.varName = p.next().val
+		p.next()
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f.name = name
+	if p.peek(0).kind == tokLang {
+		spec := p.next().val
+		if spec == "*" {
+			f.allLangs = true
+		} else {
+			f.langs = strings.Split(spec, ":")
+		}
+	}
+	switch name {
+	case "expand", "count":
+		if err = p.expect(tokPunct, "("); err != nil {
+			return nil, err
+		}
+		inner, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(tokPunct, ")"); err != nil {
+			return nil, err
+		}
+		f.name = fmt.Sprintf("%s(%s)", name, inner)
+	default:
+		if p.is(tokPunct, "(") {
+			p.next()
+			for !p.is(tokPunct, ")") {
+				key, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err = p.expect(tokPunct, ":"); err != nil {
+					return nil, err
+				}
+				f.params[key] = p.resolve(p.next().val)
+				if p.is(tokPunct, ",") {
+					p.next()
+				}
+			}
+			p.next()
+		}
+	}
+	if f.alias == "" {
+		f.alias = f.name
+		if len(f.langs) > 0 {
+			f.alias = f.name + "@" + strings.Join(f.langs, ":")
+		}
+	}
+	if err = p.parseDirectives(f); err != nil {
+		return nil, err
+	}
+	if p.is(tokPunct, "{") {
+		f.isEdge = true
+		if f.children, err = p.parseFields(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// parseFilter 解析过滤表达式，AND 优先级高于 OR
+func (p *parser) parseFilter() (*filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(0).kind == tokName && strings.EqualFold(p.peek(0).val, "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterExpr{op: "or", kids: []*filterExpr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (*filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(0).kind == tokName && strings.EqualFold(p.peek(0).val, "and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterExpr{op: "and", kids: []*filterExpr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (*filterExpr, error) {
+	if p.peek(0).kind == tokName && strings.EqualFold(p.peek(0).val, "not") {
+		p.next()
+		kid, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterExpr{op: "not", kids: []*filterExpr{kid}}, nil
+	}
+	if p.is(tokPunct, "(") {
+		p.next()
+		e, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(tokPunct, ")")
+	}
+	fn, err := p.parseFunc()
+	if err != nil {
+		return nil, err
+	}
+	return &filterExpr{op: "fn", fn: fn}, nil
+}
+
+// parseFunc 解析函数调用 name(arg, ...)
+func (p *parser) parseFunc() (*funcCall, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(tokPunct, "("); err != nil {
+		return nil, err
+	}
+	var fn = &funcCall{name: name}
+	for !p.is(tokPunct, ")") {
+		a, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		fn.args = append(fn.args, a)
+		if p.is(tokPunct, ",") {
+			p.next()
+		}
+	}
+	p.next()
+	return fn, nil
+}
+
+func (p *parser) parseArg() (arg, error) {
+	t := p.peek(0)
+	switch {
+	case t.kind == tokPunct && t.val == "[":
+		p.next()
+		var a = arg{kind: tokPunct}
+		for !p.is(tokPunct, "]") {
+			item, err := p.parseArg()
+			if err != nil {
+				return a, err
+			}
+			a.list = append(a.list, item)
+			if p.is(tokPunct, ",") {
+				p.next()
+			}
+		}
+		p.next()
+		return a, nil
+	case t.kind == tokName && p.peek(1).kind == tokPunct && p.peek(1).val == "(":
+		fn, err := p.parseFunc()
+		if err != nil {
+			return arg{}, err
+		}
+		return arg{call: fn}, nil
+	case t.kind == tokName:
+		p.next()
+		if strings.HasPrefix(t.val, "$") {
+			v, ok := p.vars[t.val]
+			if !ok {
+				return arg{}, p.errorf("undefined variable %s", t.val)
+			}
+			return arg{kind: tokString, val: v}, nil
+		}
+		a := arg{kind: tokName, val: t.val}
+		if p.peek(0).kind == tokLang {
+			a.lang = p.next().val
+		}
+		return a, nil
+	case t.kind == tokString || t.kind == tokRegex:
+		p.next()
+		return arg{kind: t.kind, val: t.val, flags: t.flags}, nil
+	}
+	return arg{}, p.errorf("unexpected argument")
+}
+
+// resolve 将 $var 替换为变量值
+func (p *parser) resolve(s string) string {
+	if v, ok := p.vars[s]; ok && strings.HasPrefix(s, "$") {
+		return v
+	}
+	return s
+}
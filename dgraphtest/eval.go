@@ -0,0 +1,845 @@
+package dgraphtest
+
+import (
+	"fmt"
+	"github.com/golang-common/dgraph"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// evaluator 在 store 上执行查询块，vars 保存查询中定义的uid变量
+type evaluator struct {
+	s    *store
+	vars map[string][]uint64
+}
+
+func newEvaluator(s *store) *evaluator {
+	return &evaluator{s: s, vars: make(map[string][]uint64)}
+}
+
+// run 按变量依赖顺序执行查询块，返回以块名为键的结果
+func (e *evaluator) run(blocks []*block) (map[string]any, error) {
+	var (
+		out     = make(map[string]any)
+		pending = blocks
+	)
+	for len(pending) > 0 {
+		var rest []*block
+		for _, b := range pending {
+			if !e.ready(b, pending) {
+				rest = append(rest, b)
+				continue
+			}
+			if err := e.evalBlock(b, out); err != nil {
+				return nil, err
+			}
+		}
+		if len(rest) == len(pending) {
+			return nil, fmt.Errorf("cyclic variable dependency in query")
+		}
+		pending = rest
+	}
+	return out, nil
+}
+
+// ready 判断查询块使用的变量是否都已由其他块计算完成
+func (e *evaluator) ready(b *block, pending []*block) bool {
+	for _, name := range usedVars(&b.field, b.root) {
+		if _, ok := e.vars[name]; ok {
+			continue
+		}
+		for _, other := range pending {
+			if other != b && containsString(definedVars(&other.field), name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// usedVars 返回查询块中 uid(x) 引用的变量
+func usedVars(f *field, root *funcCall) []string {
+	var r []string
+	var walkFn func(fn *funcCall)
+	walkFn = func(fn *funcCall) {
+		if fn == nil {
+			return
+		}
+		var walkArg func(a arg)
+		walkArg = func(a arg) {
+			switch {
+			case a.call != nil:
+				walkFn(a.call)
+			case a.list != nil:
+				for _, item := range a.list {
+					walkArg(item)
+				}
+			case a.kind == tokName && (fn.name == "uid" || fn.name == "len") && !strings.HasPrefix(a.val, "0x"):
+				r = append(r, a.val)
+			}
+		}
+		for _, a := range fn.args {
+			walkArg(a)
+		}
+	}
+	var walkExpr func(x *filterExpr)
+	walkExpr = func(x *filterExpr) {
+		if x == nil {
+			return
+		}
+		walkFn(x.fn)
+		for _, kid := range x.kids {
+			walkExpr(kid)
+		}
+	}
+	walkFn(root)
+	var walkField func(f *field)
+	walkField = func(f *field) {
+		walkExpr(f.filter)
+		for _, c := range f.children {
+			walkField(c)
+		}
+	}
+	walkField(f)
+	return r
+}
+
+// definedVars 返回查询块中 x as ... 定义的变量
+func definedVars(f *field) []string {
+	var r []string
+	if f.varName != "" {
+		r = append(r, f.varName)
+	}
+	for _, c := range f.children {
+		r = append(r, definedVars(c)...)
+	}
+	return r
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *evaluator) addVar(name string, uids ...uint64) {
+	e.vars[name] = mergeUids(e.vars[name], uids)
+}
+
+// mergeUids 合并去重并升序排列
+func mergeUids(a, b []uint64) []uint64 {
+	seen := make(map[uint64]bool, len(a)+len(b))
+	r := make([]uint64, 0, len(a)+len(b))
+	for _, list := range [][]uint64{a, b} {
+		for _, uid := range list {
+			if !seen[uid] {
+				seen[uid] = true
+				r = append(r, uid)
+			}
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
+func (e *evaluator) evalBlock(b *block, out map[string]any) error {
+	if b.schema {
+		for k, v := range e.s.schemaJSON(b.schemaPreds, b.schemaTypes) {
+			out[k] = v
+		}
+		return nil
+	}
+	// 变量即使没有结果也视为已定义
+	for _, name := range definedVars(&b.field) {
+		if _, ok := e.vars[name]; !ok {
+			e.vars[name] = []uint64{}
+		}
+	}
+	uids, err := e.rootUids(b.root)
+	if err != nil {
+		return err
+	}
+	if uids, err = e.filterUids(uids, b.filter); err != nil {
+		return err
+	}
+	if uids, err = e.paginate(uids, b.params); err != nil {
+		return err
+	}
+	if b.varName != "" {
+		e.addVar(b.varName, uids...)
+	}
+	// 与dgraph一致，根块中的 count(uid) 统计匹配的节点数，单独作为一个结果输出
+	var (
+		children []*field
+		counts   = make(map[string]any)
+	)
+	for _, f := range b.children {
+		if f.name == "count(uid)" {
+			alias := f.alias
+			if alias == f.name {
+				alias = "count"
+			}
+			counts[alias] = len(uids)
+			continue
+		}
+		children = append(children, f)
+	}
+	var list = make([]any, 0, len(uids)+1)
+	for _, uid := range uids {
+		obj, err := e.object(uid, children)
+		if err != nil {
+			return err
+		}
+		if len(obj) > 0 {
+			list = append(list, obj)
+		}
+	}
+	if len(counts) > 0 {
+		list = append(list, counts)
+	}
+	if b.name != "var" {
+		out[b.name] = list
+	}
+	return nil
+}
+
+// rootUids 根函数匹配的节点
+func (e *evaluator) rootUids(fn *funcCall) ([]uint64, error) {
+	if fn.name == "uid" {
+		return e.uidArgs(fn.args)
+	}
+	var r []uint64
+	for _, uid := range e.s.sortedUids() {
+		ok, err := e.match(uid, fn)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			r = append(r, uid)
+		}
+	}
+	return r, nil
+}
+
+// uidArgs 解析 uid() 的参数，支持UID、变量和列表
+func (e *evaluator) uidArgs(args []arg) ([]uint64, error) {
+	var r []uint64
+	for _, a := range args {
+		switch {
+		case a.list != nil:
+			sub, err := e.uidArgs(a.list)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, sub...)
+		case a.kind == tokString:
+			// 通过 $var 传入的UID可以用逗号分隔多个
+			for _, s := range strings.Split(a.val, ",") {
+				uid, err := parseUid(strings.TrimSpace(s))
+				if err != nil {
+					return nil, err
+				}
+				r = append(r, uid)
+			}
+		case strings.HasPrefix(a.val, "0x"):
+			uid, err := parseUid(a.val)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, uid)
+		default:
+			r = append(r, e.vars[a.val]...)
+		}
+	}
+	return mergeUids(r, nil), nil
+}
+
+func (e *evaluator) filterUids(uids []uint64, x *filterExpr) ([]uint64, error) {
+	if x == nil {
+		return uids, nil
+	}
+	var r []uint64
+	for _, uid := range uids {
+		ok, err := evalExpr(x, func(fn *funcCall) (bool, error) {
+			return e.match(uid, fn)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			r = append(r, uid)
+		}
+	}
+	return r, nil
+}
+
+// evalExpr 计算逻辑表达式，fn 计算单个函数
+func evalExpr(x *filterExpr, fn func(fn *funcCall) (bool, error)) (bool, error) {
+	switch x.op {
+	case "and":
+		for _, kid := range x.kids {
+			ok, err := evalExpr(kid, fn)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case "or":
+		for _, kid := range x.kids {
+			ok, err := evalExpr(kid, fn)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case "not":
+		ok, err := evalExpr(x.kids[0], fn)
+		return !ok, err
+	}
+	return fn(x.fn)
+}
+
+// match 判断节点是否满足函数
+func (e *evaluator) match(uid uint64, fn *funcCall) (bool, error) {
+	n := e.s.nodes[uid]
+	switch fn.name {
+	case "uid":
+		uids, err := e.uidArgs(fn.args)
+		if err != nil {
+			return false, err
+		}
+		return containsUid(uids, uid), nil
+	case "has":
+		if len(fn.args) != 1 {
+			return false, fmt.Errorf("has expects one argument")
+		}
+		pred := fn.args[0].val
+		if strings.HasPrefix(pred, "~") {
+			return len(e.reverse(uid, pred[1:])) > 0, nil
+		}
+		return len(n[pred]) > 0, nil
+	case "type":
+		if len(fn.args) != 1 {
+			return false, fmt.Errorf("type expects one argument")
+		}
+		for _, v := range n[typePred] {
+			if v.val == fn.args[0].val {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "uid_in":
+		if len(fn.args) < 2 {
+			return false, fmt.Errorf("uid_in expects a predicate and uids")
+		}
+		uids, err := e.uidArgs(fn.args[1:])
+		if err != nil {
+			return false, err
+		}
+		for _, v := range n[fn.args[0].val] {
+			if v.uid != 0 && containsUid(uids, v.uid) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "eq", "lt", "le", "gt", "ge", "between",
+		"anyofterms", "allofterms", "anyoftext", "alloftext", "regexp":
+		return e.matchValue(uid, fn)
+	}
+	return false, fmt.Errorf("function %s is not supported", fn.name)
+}
+
+func containsUid(list []uint64, uid uint64) bool {
+	i := sort.Search(len(list), func(i int) bool { return list[i] >= uid })
+	return i < len(list) && list[i] == uid
+}
+
+// matchValue 比较谓词值，任一值满足即匹配
+func (e *evaluator) matchValue(uid uint64, fn *funcCall) (bool, error) {
+	if len(fn.args) < 2 {
+		return false, fmt.Errorf("%s expects a predicate and a value", fn.name)
+	}
+	var (
+		target = fn.args[0]
+		vals   []any
+	)
+	switch {
+	case target.call != nil && target.call.name == "count" && len(target.call.args) == 1:
+		vals = []any{int64(len(e.s.nodes[uid][target.call.args[0].val]))}
+	case target.call != nil:
+		return false, fmt.Errorf("%s(%s(...)) is not supported", fn.name, target.call.name)
+	default:
+		for _, v := range langValues(e.s.nodes[uid][target.val], langList(target.lang)) {
+			vals = append(vals, v.val)
+		}
+	}
+	var args []string
+	for _, a := range fn.args[1:] {
+		if a.list != nil {
+			for _, item := range a.list {
+				args = append(args, item.val)
+			}
+			continue
+		}
+		args = append(args, a.val)
+	}
+	for _, v := range vals {
+		ok, err := matchOne(fn.name, v, args, fn.args[1])
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func matchOne(name string, v any, args []string, raw arg) (bool, error) {
+	switch name {
+	case "eq":
+		for _, a := range args {
+			c, err := compare(v, a)
+			if err != nil {
+				return false, err
+			}
+			if c == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "lt", "le", "gt", "ge":
+		c, err := compare(v, args[0])
+		if err != nil {
+			return false, err
+		}
+		switch name {
+		case "lt":
+			return c < 0, nil
+		case "le":
+			return c <= 0, nil
+		case "gt":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "between":
+		if len(args) != 2 {
+			return false, fmt.Errorf("between expects two values")
+		}
+		lo, err := compare(v, args[0])
+		if err != nil {
+			return false, err
+		}
+		hi, err := compare(v, args[1])
+		if err != nil {
+			return false, err
+		}
+		return lo >= 0 && hi <= 0, nil
+	case "anyofterms", "anyoftext", "allofterms", "alloftext":
+		s, ok := v.(string)
+		if !ok {
+			return false, nil
+		}
+		have := terms(s)
+		want := terms(strings.Join(args, " "))
+		all := strings.HasPrefix(name, "all")
+		for _, t := range want {
+			found := containsString(have, t)
+			if found && !all {
+				return true, nil
+			}
+			if !found && all {
+				return false, nil
+			}
+		}
+		return all && len(want) > 0, nil
+	case "regexp":
+		s, ok := v.(string)
+		if !ok {
+			return false, nil
+		}
+		pattern := raw.val
+		if strings.Contains(raw.flags, "i") {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(s), nil
+	}
+	return false, fmt.Errorf("function %s is not supported", name)
+}
+
+// terms 按非字母数字切分并转为小写
+func terms(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// compare 将字符串参数按存储值的类型转换后比较
+func compare(v any, s string) (int, error) {
+	switch x := v.(type) {
+	case string:
+		return strings.Compare(x, s), nil
+	case int64:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return compareOrdered(x, i), nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot compare int with %q", s)
+		}
+		return compareOrdered(float64(x), f), nil
+	case float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot compare float with %q", s)
+		}
+		return compareOrdered(x, f), nil
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return 0, fmt.Errorf("cannot compare bool with %q", s)
+		}
+		if x == b {
+			return 0, nil
+		}
+		return 1, nil
+	case time.Time:
+		t, err := parseTime(s)
+		if err != nil {
+			return 0, fmt.Errorf("cannot compare datetime with %q", s)
+		}
+		return x.Compare(t), nil
+	}
+	return strings.Compare(fmt.Sprint(v), s), nil
+}
+
+func compareOrdered[T int64 | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareValues 比较两个存储值，用于排序
+func compareValues(a, b any) int {
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return compareOrdered(x, y)
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			return compareOrdered(x, y)
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// langList 将语言标签文本拆分为列表
+func langList(spec string) []string {
+	if spec == "" {
+		return nil
+	}
+	return strings.Split(spec, ":")
+}
+
+// langValues 按语言标签选择值，langs 为空时只返回无语言标签的值，"." 表示任意语言
+func langValues(vals []value, langs []string) []value {
+	if len(langs) == 0 {
+		langs = []string{""}
+	}
+	for _, lang := range langs {
+		var r []value
+		if lang == "." {
+			for _, v := range vals {
+				if v.lang == "" {
+					return []value{v}
+				}
+			}
+			if len(vals) > 0 {
+				return vals[:1]
+			}
+			continue
+		}
+		for _, v := range vals {
+			if v.lang == lang {
+				r = append(r, v)
+			}
+		}
+		if len(r) > 0 {
+			return r
+		}
+	}
+	return nil
+}
+
+// reverse 返回指向 uid 的 pred 边，value.uid 为边的起点
+func (e *evaluator) reverse(uid uint64, pred string) []value {
+	var r []value
+	for _, src := range e.s.sortedUids() {
+		for _, v := range e.s.nodes[src][pred] {
+			if v.uid == uid {
+				r = append(r, value{uid: src, facets: v.facets})
+			}
+		}
+	}
+	return r
+}
+
+// paginate 按 orderasc、orderdesc、after、offset、first 参数处理结果
+func (e *evaluator) paginate(uids []uint64, params map[string]string) ([]uint64, error) {
+	for _, key := range []string{"orderasc", "orderdesc"} {
+		pred, ok := params[key]
+		if !ok {
+			continue
+		}
+		first := func(uid uint64) (any, bool) {
+			vals := langValues(e.s.nodes[uid][pred], nil)
+			if len(vals) == 0 {
+				return nil, false
+			}
+			return vals[0].val, true
+		}
+		sort.SliceStable(uids, func(i, j int) bool {
+			a, aok := first(uids[i])
+			b, bok := first(uids[j])
+			if !aok || !bok {
+				return aok && !bok
+			}
+			if key == "orderasc" {
+				return compareValues(a, b) < 0
+			}
+			return compareValues(a, b) > 0
+		})
+	}
+	if after, ok := params["after"]; ok {
+		a, err := parseUid(after)
+		if err != nil {
+			return nil, err
+		}
+		var r []uint64
+		for _, uid := range uids {
+			if uid > a {
+				r = append(r, uid)
+			}
+		}
+		uids = r
+	}
+	if s, ok := params["offset"]; ok {
+		offset, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset %s", s)
+		}
+		if offset > len(uids) {
+			offset = len(uids)
+		}
+		uids = uids[offset:]
+	}
+	if s, ok := params["first"]; ok {
+		first, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid first %s", s)
+		}
+		switch {
+		case first >= 0 && first < len(uids):
+			uids = uids[:first]
+		case first < 0 && -first < len(uids):
+			uids = uids[len(uids)+first:]
+		}
+	}
+	return uids, nil
+}
+
+// object 生成节点的查询结果
+func (e *evaluator) object(uid uint64, fields []*field) (map[string]any, error) {
+	obj := make(map[string]any)
+	for _, f := range fields {
+		if err := e.field(uid, f, obj); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+func (e *evaluator) field(uid uint64, f *field, obj map[string]any) error {
+	switch {
+	case f.name == "uid":
+		obj[f.alias] = formatUid(uid)
+		if f.varName != "" {
+			e.addVar(f.varName, uid)
+		}
+		return nil
+	case f.name == "expand(_all_)":
+		for _, v := range e.s.nodes[uid][typePred] {
+			name, _ := v.val.(string)
+			for _, tf := range e.s.types[name].Fields {
+				sub := &field{name: tf.Name, alias: tf.Name, children: f.children, isEdge: len(f.children) > 0}
+				if err := e.field(uid, sub, obj); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case strings.HasPrefix(f.name, "count(") && strings.HasSuffix(f.name, ")"):
+		pred := f.name[len("count(") : len(f.name)-1]
+		var n int
+		if strings.HasPrefix(pred, "~") {
+			n = len(e.reverse(uid, pred[1:]))
+		} else {
+			n = len(e.s.nodes[uid][pred])
+		}
+		obj[f.alias] = n
+		return nil
+	}
+	var (
+		name    = strings.TrimPrefix(f.name, "~")
+		reverse = name != f.name
+		sp      = e.s.preds[name]
+		vals    []value
+	)
+	if reverse {
+		vals = e.reverse(uid, name)
+	} else {
+		vals = e.s.nodes[uid][name]
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+	if vals[0].uid != 0 {
+		return e.edge(f, vals, !reverse && !sp.List, obj)
+	}
+	// 与dgraph一致，password 类型的谓词不能直接查询
+	if sp.Type == dgraph.TypePassword {
+		return nil
+	}
+	if f.allLangs {
+		for _, v := range vals {
+			key := f.alias
+			if v.lang != "" {
+				key = f.name + "@" + v.lang
+			}
+			obj[key] = jsonValue(v.val)
+		}
+		return nil
+	}
+	selected := langValues(vals, f.langs)
+	if len(selected) == 0 {
+		return nil
+	}
+	if f.varName != "" {
+		e.addVar(f.varName, uid)
+	}
+	if sp.List {
+		list := make([]any, 0, len(selected))
+		for _, v := range selected {
+			list = append(list, jsonValue(v.val))
+		}
+		obj[f.alias] = list
+		return nil
+	}
+	obj[f.alias] = jsonValue(selected[0].val)
+	for k, fv := range selected[0].facets {
+		if f.wantFacet(k) {
+			obj[f.alias+"|"+k] = jsonValue(fv)
+		}
+	}
+	return nil
+}
+
+// edge 输出uid谓词的子节点，边属性以 pred|facet 为键写入子节点
+func (e *evaluator) edge(f *field, vals []value, single bool, obj map[string]any) error {
+	var uids []uint64
+	facets := make(map[uint64]map[string]any, len(vals))
+	for _, v := range vals {
+		uids = append(uids, v.uid)
+		facets[v.uid] = v.facets
+	}
+	uids, err := e.filterUids(uids, f.filter)
+	if err != nil {
+		return err
+	}
+	if uids, err = e.paginate(uids, f.params); err != nil {
+		return err
+	}
+	if f.varName != "" {
+		e.addVar(f.varName, uids...)
+	}
+	var items []any
+	for _, uid := range uids {
+		child, err := e.object(uid, f.children)
+		if err != nil {
+			return err
+		}
+		for k, fv := range facets[uid] {
+			if f.wantFacet(k) {
+				child[f.alias+"|"+k] = jsonValue(fv)
+			}
+		}
+		if len(child) > 0 {
+			items = append(items, child)
+		}
+	}
+	switch {
+	case len(items) == 0:
+	case single:
+		obj[f.alias] = items[0]
+	default:
+		obj[f.alias] = items
+	}
+	return nil
+}
+
+func (f *field) wantFacet(key string) bool {
+	return f.hasFacet && (f.facetAll || containsString(f.facets, key))
+}
+
+// evalCond 计算upsert块中 @if(...) 条件，只支持 len(var) 的比较
+func (e *evaluator) evalCond(cond string) (bool, error) {
+	cond = strings.TrimSpace(cond)
+	if cond == "" {
+		return true, nil
+	}
+	toks, err := tokenize(cond)
+	if err != nil {
+		return false, err
+	}
+	p := &parser{toks: toks}
+	if err = p.expect(tokPunct, "@"); err != nil {
+		return false, err
+	}
+	if err = p.expect(tokName, "if"); err != nil {
+		return false, err
+	}
+	if err = p.expect(tokPunct, "("); err != nil {
+		return false, err
+	}
+	x, err := p.parseFilter()
+	if err != nil {
+		return false, err
+	}
+	if err = p.expect(tokPunct, ")"); err != nil {
+		return false, err
+	}
+	return evalExpr(x, func(fn *funcCall) (bool, error) {
+		if len(fn.args) != 2 || fn.args[0].call == nil || fn.args[0].call.name != "len" || len(fn.args[0].call.args) != 1 {
+			return false, fmt.Errorf("unsupported condition %s", cond)
+		}
+		n := int64(len(e.vars[fn.args[0].call.args[0].val]))
+		return matchOne(fn.name, n, []string{fn.args[1].val}, fn.args[1])
+	})
+}
@@ -0,0 +1,189 @@
+package dgraphtest
+
+import (
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"strings"
+)
+
+// op 事务中的一次写入，提交时按顺序重放到已提交的数据上
+type op struct {
+	del  bool
+	all  bool // 删除谓词的所有值
+	node bool // 删除节点的所有谓词
+	uid  uint64
+	pred string
+	v    value
+}
+
+// key 冲突检测使用的键
+func (o op) key() string {
+	return formatUid(o.uid)
+}
+
+func (s *store) apply(o op) {
+	switch {
+	case o.node:
+		delete(s.nodes, o.uid)
+	case o.del:
+		s.del(o.uid, o.pred, o.v, o.all)
+	default:
+		s.set(o.uid, o.pred, o.v)
+	}
+}
+
+// mutator 将 api.Mutation 转换为写入操作
+// blanks 记录空白节点分配的UID，alloc 分配新的UID
+type mutator struct {
+	s      *store
+	e      *evaluator
+	blanks map[string]uint64
+	alloc  func() uint64
+}
+
+// mutation 转换单个 api.Mutation，set 在前、delete 在后
+func (m *mutator) mutation(mu *api.Mutation) ([]op, error) {
+	if len(mu.SetJson) > 0 || len(mu.DeleteJson) > 0 {
+		return nil, fmt.Errorf("json mutations are not supported by dgraphtest")
+	}
+	var (
+		set = mu.Set
+		del = mu.Del
+	)
+	if len(mu.SetNquads) > 0 {
+		nqs, err := parseRdf(string(mu.SetNquads))
+		if err != nil {
+			return nil, err
+		}
+		set = append(append([]*api.NQuad(nil), set...), nqs...)
+	}
+	if len(mu.DelNquads) > 0 {
+		nqs, err := parseRdf(string(mu.DelNquads))
+		if err != nil {
+			return nil, err
+		}
+		del = append(append([]*api.NQuad(nil), del...), nqs...)
+	}
+	if len(set) == 0 && len(del) == 0 {
+		return nil, fmt.Errorf("empty mutation")
+	}
+	r, err := m.nquads(set, false)
+	if err != nil {
+		return nil, err
+	}
+	dels, err := m.nquads(del, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(r, dels...), nil
+}
+
+func (m *mutator) nquads(nqs []*api.NQuad, del bool) ([]op, error) {
+	var r []op
+	for _, nq := range nqs {
+		subjects, err := m.resolve(nq.Subject, !del)
+		if err != nil {
+			return nil, err
+		}
+		if nq.Predicate == "" {
+			return nil, fmt.Errorf("empty predicate for subject %s", nq.Subject)
+		}
+		star := nq.Predicate == "*" || nq.Predicate == dgraph.StarAll
+		if star && !del {
+			return nil, fmt.Errorf("cannot set predicate * for subject %s", nq.Subject)
+		}
+		objects, err := m.objects(nq, del)
+		if err != nil {
+			return nil, err
+		}
+		for _, uid := range subjects {
+			if star {
+				r = append(r, op{del: true, node: true, uid: uid})
+				continue
+			}
+			if objects == nil {
+				r = append(r, op{del: true, all: true, uid: uid, pred: nq.Predicate})
+				continue
+			}
+			for _, v := range objects {
+				r = append(r, op{del: del, uid: uid, pred: nq.Predicate, v: v})
+			}
+		}
+	}
+	return r, nil
+}
+
+// resolve 解析主语或宾语的节点，支持 _:blank、0x1 和 uid(var)
+// create 为 false 时未出现过的空白节点不会分配UID
+func (m *mutator) resolve(s string, create bool) ([]uint64, error) {
+	switch {
+	case strings.HasPrefix(s, "_:"):
+		name := s[2:]
+		if uid, ok := m.blanks[name]; ok {
+			return []uint64{uid}, nil
+		}
+		if !create {
+			return nil, nil
+		}
+		uid := m.alloc()
+		m.blanks[name] = uid
+		return []uint64{uid}, nil
+	case strings.HasPrefix(s, "uid(") && strings.HasSuffix(s, ")"):
+		return m.e.vars[strings.TrimSpace(s[4:len(s)-1])], nil
+	case strings.HasPrefix(s, "0x"):
+		uid, err := parseUid(s)
+		if err != nil {
+			return nil, err
+		}
+		if uid == 0 {
+			return nil, fmt.Errorf("uid 0x0 is not allowed")
+		}
+		return []uint64{uid}, nil
+	}
+	return nil, fmt.Errorf("invalid node reference %q", s)
+}
+
+// objects 解析宾语，删除谓词的所有值时返回 nil
+func (m *mutator) objects(nq *api.NQuad, del bool) ([]value, error) {
+	facets := make(map[string]any, len(nq.Facets))
+	for _, f := range nq.Facets {
+		v, err := facetValue(f)
+		if err != nil {
+			return nil, err
+		}
+		facets[f.Key] = v
+	}
+	if len(facets) == 0 {
+		facets = nil
+	}
+	sp, defined := m.s.preds[nq.Predicate]
+	if nq.ObjectId != "" {
+		if defined && sp.Type != dgraph.TypeUid {
+			return nil, fmt.Errorf("input for predicate %s of type %s is uid", nq.Predicate, sp.Type)
+		}
+		uids, err := m.resolve(nq.ObjectId, !del)
+		if err != nil {
+			return nil, err
+		}
+		r := make([]value, 0, len(uids))
+		for _, uid := range uids {
+			r = append(r, value{uid: uid, facets: facets})
+		}
+		return r, nil
+	}
+	if nq.ObjectValue == nil {
+		return nil, fmt.Errorf("predicate %s has no object", nq.Predicate)
+	}
+	if dv, ok := nq.ObjectValue.Val.(*api.Value_DefaultVal); ok && del && (dv.DefaultVal == dgraph.StarAll || dv.DefaultVal == "*") {
+		return nil, nil
+	}
+	if defined && sp.Type == dgraph.TypeUid {
+		return nil, fmt.Errorf("input for predicate %s of type uid is scalar", nq.Predicate)
+	}
+	v, err := m.s.convert(nq.Predicate, nq.ObjectValue)
+	if err != nil {
+		return nil, err
+	}
+	return []value{{val: v, lang: nq.Lang, facets: facets}}, nil
+}
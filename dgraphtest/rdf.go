@@ -0,0 +1,206 @@
+package dgraphtest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// rdfTypes RDF类型到 api.Value 的转换
+var rdfTypes = map[string]func(s string) (*api.Value, error){
+	"xs:string": func(s string) (*api.Value, error) {
+		return &api.Value{Val: &api.Value_StrVal{StrVal: s}}, nil
+	},
+	"xs:int": func(s string) (*api.Value, error) {
+		i, err := strconv.ParseInt(s, 10, 64)
+		return &api.Value{Val: &api.Value_IntVal{IntVal: i}}, err
+	},
+	"xs:float": func(s string) (*api.Value, error) {
+		f, err := strconv.ParseFloat(s, 64)
+		return &api.Value{Val: &api.Value_DoubleVal{DoubleVal: f}}, err
+	},
+	"xs:boolean": func(s string) (*api.Value, error) {
+		b, err := strconv.ParseBool(s)
+		return &api.Value{Val: &api.Value_BoolVal{BoolVal: b}}, err
+	},
+	"xs:dateTime": func(s string) (*api.Value, error) {
+		t, err := parseTime(s)
+		if err != nil {
+			return nil, err
+		}
+		b, err := t.MarshalBinary()
+		return &api.Value{Val: &api.Value_DatetimeVal{DatetimeVal: b}}, err
+	},
+	"geo:geojson": func(s string) (*api.Value, error) {
+		return &api.Value{Val: &api.Value_GeoVal{GeoVal: []byte(s)}}, nil
+	},
+}
+
+// parseRdf 解析 SetNquads、DelNquads 中的RDF文本，每行一个 N-Quad
+func parseRdf(text string) ([]*api.NQuad, error) {
+	var r []*api.NQuad
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		nq, err := parseRdfLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("rdf line %d: %s", i+1, err)
+		}
+		r = append(r, nq)
+	}
+	return r, nil
+}
+
+func parseRdfLine(line string) (*api.NQuad, error) {
+	var (
+		nq   = new(api.NQuad)
+		rest = line
+		err  error
+	)
+	if nq.Subject, rest, err = rdfNode(rest); err != nil {
+		return nil, err
+	}
+	if nq.Predicate, rest, err = rdfNode(rest); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(rest, `"`) {
+		var lit string
+		if lit, rest, err = rdfString(rest); err != nil {
+			return nil, err
+		}
+		nq.ObjectValue = &api.Value{Val: &api.Value_DefaultVal{DefaultVal: lit}}
+		switch {
+		case strings.HasPrefix(rest, "@"):
+			end := strings.IndexAny(rest, " \t(.")
+			if end < 0 {
+				return nil, fmt.Errorf("missing terminating .")
+			}
+			nq.Lang, rest = rest[1:end], strings.TrimSpace(rest[end:])
+		case strings.HasPrefix(rest, "^^<"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated type")
+			}
+			typ := rest[3:end]
+			conv, ok := rdfTypes[typ]
+			if !ok {
+				return nil, fmt.Errorf("unsupported type %s", typ)
+			}
+			if nq.ObjectValue, err = conv(lit); err != nil {
+				return nil, err
+			}
+			rest = strings.TrimSpace(rest[end+1:])
+		}
+	} else {
+		var obj string
+		if obj, rest, err = rdfNode(rest); err != nil {
+			return nil, err
+		}
+		if obj == "*" {
+			nq.ObjectValue = &api.Value{Val: &api.Value_DefaultVal{DefaultVal: obj}}
+		} else {
+			nq.ObjectId = obj
+		}
+	}
+	if strings.HasPrefix(rest, "(") {
+		end := strings.LastIndexByte(rest, ')')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated facets")
+		}
+		if nq.Facets, err = rdfFacets(rest[1:end]); err != nil {
+			return nil, err
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	if rest != "." {
+		return nil, fmt.Errorf("expected terminating . but got %q", rest)
+	}
+	return nq, nil
+}
+
+// rdfNode 解析 <iri>、_:blank、uid(var) 或 *
+func rdfNode(s string) (string, string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "<"):
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated <")
+		}
+		return s[1:end], strings.TrimSpace(s[end+1:]), nil
+	case strings.HasPrefix(s, "uid("):
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated uid(")
+		}
+		return s[:end+1], strings.TrimSpace(s[end+1:]), nil
+	case strings.HasPrefix(s, "_:"), strings.HasPrefix(s, "*"):
+		end := strings.IndexAny(s, " \t")
+		if end < 0 {
+			return "", "", fmt.Errorf("missing terminating .")
+		}
+		return s[:end], strings.TrimSpace(s[end:]), nil
+	}
+	return "", "", fmt.Errorf("invalid node %q", s)
+}
+
+// rdfString 解析带转义的字符串字面量
+func rdfString(s string) (string, string, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return sb.String(), strings.TrimSpace(s[i+1:]), nil
+		case '\\':
+			i++
+			if i >= len(s) {
+				break
+			}
+			switch s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(s[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// rdfFacets 解析 key=value, ... 形式的边属性
+func rdfFacets(s string) ([]*api.Facet, error) {
+	var r []*api.Facet
+	for _, part := range strings.Split(s, ",") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid facet %q", part)
+		}
+		f := &api.Facet{Key: strings.TrimSpace(key)}
+		val = strings.TrimSpace(val)
+		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+			f.ValType, f.Value = api.Facet_INT, binary.LittleEndian.AppendUint64(nil, uint64(i))
+		} else if fl, err := strconv.ParseFloat(val, 64); err == nil {
+			f.ValType, f.Value = api.Facet_FLOAT, binary.LittleEndian.AppendUint64(nil, math.Float64bits(fl))
+		} else if val == "true" || val == "false" {
+			f.ValType, f.Value = api.Facet_BOOL, []byte(val)
+		} else if str, _, err := rdfString(val); err == nil {
+			f.ValType, f.Value = api.Facet_STRING, []byte(str)
+			if _, err = parseTime(str); err == nil {
+				f.ValType = api.Facet_DATETIME
+			}
+		} else {
+			return nil, fmt.Errorf("invalid facet value %q", val)
+		}
+		r = append(r, f)
+	}
+	return r, nil
+}
@@ -0,0 +1,422 @@
+// Package dgraphtest 提供进程内的dgraph测试服务，用于在 go test 中运行依赖 dgraph.Client 的代码
+//
+// 服务通过 bufconn 提供 api.DgraphServer，数据保存在内存中，支持schema变更、
+// N-Quad 的写入与删除、upsert 条件、schema{} 查询以及常用的DQL子集：
+// uid、eq、has、type、uid_in、比较和分词函数、@filter、分页排序、嵌套边、反向边、边属性和语言标签
+package dgraphtest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Target 测试服务的虚拟地址，只能配合 Dialer 使用
+	Target  = "bufnet"
+	Version = "dgraphtest"
+)
+
+// ServerOption NewServer 的可选参数
+type ServerOption func(s *Server)
+
+// WithUser 开启ACL并添加用户，开启后所有请求都需要先登录
+func WithUser(userid, password string) ServerOption {
+	return func(s *Server) {
+		s.users[userid] = password
+	}
+}
+
+// WithTokenTTL 设置登录返回的 access token 和 refresh token 有效期
+func WithTokenTTL(access, refresh time.Duration) ServerOption {
+	return func(s *Server) {
+		s.accessTTL = access
+		s.refreshTTL = refresh
+	}
+}
+
+// Server 内存中的dgraph服务
+type Server struct {
+	api.UnimplementedDgraphServer
+	mu         sync.Mutex
+	data       *store
+	ts         uint64
+	txns       map[uint64]*txn
+	commits    []commit
+	users      map[string]string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	lis        *bufconn.Listener
+	srv        *grpc.Server
+}
+
+// txn 未提交的事务，ws 为事务开始时数据的副本
+type txn struct {
+	startTs uint64
+	ws      *store
+	ops     []op
+	keys    map[string]bool
+}
+
+// commit 已提交事务写入的键，用于检测并发事务的冲突
+type commit struct {
+	ts   uint64
+	keys map[string]bool
+}
+
+// NewServer 创建并启动测试服务，使用完毕后调用 Close
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		data:       newStore(),
+		txns:       make(map[uint64]*txn),
+		users:      make(map[string]string),
+		accessTTL:  time.Hour,
+		refreshTTL: 24 * time.Hour,
+		lis:        bufconn.Listen(1 << 20),
+		srv:        grpc.NewServer(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	api.RegisterDgraphServer(s.srv, s)
+	go func() {
+		_ = s.srv.Serve(s.lis)
+	}()
+	return s
+}
+
+// Dialer 返回连接测试服务的拨号函数，配合 dgraph.WithContextDialer 使用
+func (s *Server) Dialer() func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return s.lis.DialContext(ctx)
+	}
+}
+
+// Client 创建连接测试服务的客户端
+func (s *Server) Client(opts ...dgraph.Option) (*dgraph.Client, error) {
+	opts = append([]dgraph.Option{dgraph.WithContextDialer(s.Dialer())}, opts...)
+	return dgraph.NewClient([]string{Target}, opts...)
+}
+
+// Reset 清空所有数据、schema和未提交的事务
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.reset()
+	s.txns = make(map[uint64]*txn)
+	s.commits = nil
+}
+
+// Close 停止服务
+func (s *Server) Close() {
+	s.srv.Stop()
+	_ = s.lis.Close()
+}
+
+// Login 校验用户密码或 refresh token 并签发新的令牌
+func (s *Server) Login(ctx context.Context, req *api.LoginRequest) (*api.Response, error) {
+	userid := req.Userid
+	if req.RefreshToken != "" {
+		claims, err := parseToken(req.RefreshToken, "refresh")
+		if err != nil {
+			return nil, err
+		}
+		userid = claims.Userid
+	} else if password, ok := s.users[userid]; len(s.users) > 0 && (!ok || password != req.Password) {
+		return nil, status.Error(codes.Unauthenticated, "invalid username or password")
+	}
+	now := time.Now()
+	jwt := &api.Jwt{
+		AccessJwt:  newToken(tokenClaims{Userid: userid, Namespace: req.Namespace, Kind: "access", Exp: now.Add(s.accessTTL).Unix()}),
+		RefreshJwt: newToken(tokenClaims{Userid: userid, Namespace: req.Namespace, Kind: "refresh", Exp: now.Add(s.refreshTTL).Unix()}),
+	}
+	b, err := jwt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &api.Response{Json: b}, nil
+}
+
+// CheckVersion 返回测试服务版本，与dgraph一致不需要登录
+func (s *Server) CheckVersion(ctx context.Context, _ *api.Check) (*api.Version, error) {
+	return &api.Version{Tag: Version}, nil
+}
+
+// Alter 修改schema或删除数据
+func (s *Server) Alter(ctx context.Context, op *api.Operation) (*api.Payload, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case op.DropAll || op.DropOp == api.Operation_ALL:
+		s.data.reset()
+	case op.DropOp == api.Operation_DATA:
+		s.data.nodes = make(map[uint64]node)
+	case op.DropOp == api.Operation_ATTR:
+		s.data.dropPred(op.DropValue)
+	case op.DropAttr != "":
+		s.data.dropPred(op.DropAttr)
+	case op.DropOp == api.Operation_TYPE:
+		delete(s.data.types, op.DropValue)
+	case op.Schema != "":
+		if err := s.data.alter(op.Schema); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "operation must have a schema or drop option")
+	}
+	return &api.Payload{Data: []byte(`{"code":"Success","message":"Done"}`)}, nil
+}
+
+// Query 执行查询和mutation，mutation 写入事务的工作区，提交时才对其他事务可见
+func (s *Server) Query(ctx context.Context, req *api.Request) (*api.Response, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var (
+		t    *txn
+		data = s.data
+		resp = &api.Response{Txn: &api.TxnContext{StartTs: req.StartTs}}
+	)
+	// 只有写入时才创建事务的工作区，只读的查询直接读取已提交的数据
+	if len(req.Mutations) > 0 {
+		t = s.txn(req.StartTs)
+		data = t.ws
+		resp.Txn.StartTs = t.startTs
+	} else if old, ok := s.txns[req.StartTs]; ok {
+		data = old.ws
+	} else if req.StartTs == 0 {
+		s.ts++
+		resp.Txn.StartTs = s.ts
+	}
+	e := newEvaluator(data)
+	out := make(map[string]any)
+	if strings.TrimSpace(req.Query) != "" {
+		blocks, err := parseQuery(req.Query, req.Vars)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if out, err = e.run(blocks); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	var err error
+	if resp.Json, err = json.Marshal(out); err != nil {
+		return nil, err
+	}
+	if len(req.Mutations) == 0 {
+		return resp, nil
+	}
+	var (
+		m     = &mutator{s: t.ws, e: e, blanks: make(map[string]uint64), alloc: s.allocUid}
+		keys  = make(map[string]bool)
+		preds = make(map[string]bool)
+	)
+	for _, mu := range req.Mutations {
+		ok, err := e.evalCond(mu.Cond)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if !ok {
+			continue
+		}
+		ops, err := m.mutation(mu)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		for _, o := range ops {
+			t.write(o)
+			keys[o.key()] = true
+			if o.pred != "" {
+				preds[o.pred] = true
+			}
+		}
+	}
+	if len(m.blanks) > 0 {
+		resp.Uids = make(map[string]string, len(m.blanks))
+		for name, uid := range m.blanks {
+			resp.Uids[name] = formatUid(uid)
+		}
+	}
+	for key := range keys {
+		resp.Txn.Keys = append(resp.Txn.Keys, key)
+	}
+	for pred := range preds {
+		resp.Txn.Preds = append(resp.Txn.Preds, "0-"+pred)
+	}
+	if commitNow(req) {
+		if resp.Txn.CommitTs, err = s.commit(t); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// commitNow 请求或其中任一 Mutation 设置了 CommitNow
+func commitNow(req *api.Request) bool {
+	if req.CommitNow {
+		return true
+	}
+	for _, mu := range req.Mutations {
+		if mu.CommitNow {
+			return true
+		}
+	}
+	return false
+}
+
+// CommitOrAbort 提交或丢弃事务，与已提交的并发事务写入相同节点时返回 codes.Aborted
+func (s *Server) CommitOrAbort(ctx context.Context, tc *api.TxnContext) (*api.TxnContext, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.txns[tc.StartTs]
+	if tc.Aborted {
+		delete(s.txns, tc.StartTs)
+		return &api.TxnContext{StartTs: tc.StartTs, Aborted: true}, nil
+	}
+	if !ok {
+		return &api.TxnContext{StartTs: tc.StartTs}, nil
+	}
+	commitTs, err := s.commit(t)
+	if err != nil {
+		return nil, err
+	}
+	return &api.TxnContext{StartTs: tc.StartTs, CommitTs: commitTs}, nil
+}
+
+// txn 返回 startTs 对应的事务，不存在时开始新事务
+func (s *Server) txn(startTs uint64) *txn {
+	if t, ok := s.txns[startTs]; ok {
+		return t
+	}
+	if startTs == 0 {
+		s.ts++
+		startTs = s.ts
+	}
+	t := &txn{startTs: startTs, ws: s.data.clone(), keys: make(map[string]bool)}
+	s.txns[startTs] = t
+	return t
+}
+
+func (t *txn) write(o op) {
+	t.ws.apply(o)
+	t.ops = append(t.ops, o)
+	t.keys[o.key()] = true
+	// @upsert 谓词的值作为冲突键，避免并发事务写入相同的唯一值
+	if p := t.ws.preds[o.pred]; p.Upsert && o.v.uid == 0 && !o.del {
+		t.keys[fmt.Sprintf("%s=%v", o.pred, o.v.val)] = true
+	}
+}
+
+// commit 检查冲突后将事务的写入重放到已提交的数据上
+func (s *Server) commit(t *txn) (uint64, error) {
+	delete(s.txns, t.startTs)
+	for _, c := range s.commits {
+		if c.ts <= t.startTs {
+			continue
+		}
+		for key := range t.keys {
+			if c.keys[key] {
+				return 0, status.Error(codes.Aborted, "Transaction has been aborted. Please retry")
+			}
+		}
+	}
+	for _, o := range t.ops {
+		s.data.apply(o)
+	}
+	s.ts++
+	s.commits = append(s.commits, commit{ts: s.ts, keys: t.keys})
+	s.pruneCommits()
+	return s.ts, nil
+}
+
+// pruneCommits 删除不会再与未提交事务冲突的提交记录
+func (s *Server) pruneCommits() {
+	var oldest = s.ts
+	for ts := range s.txns {
+		if ts < oldest {
+			oldest = ts
+		}
+	}
+	var kept []commit
+	for _, c := range s.commits {
+		if c.ts > oldest {
+			kept = append(kept, c)
+		}
+	}
+	s.commits = kept
+}
+
+func (s *Server) allocUid() uint64 {
+	uid := s.data.nextUid
+	s.data.nextUid++
+	return uid
+}
+
+// tokenClaims 测试服务签发的令牌内容
+type tokenClaims struct {
+	Userid    string `json:"userid"`
+	Namespace uint64 `json:"namespace"`
+	Kind      string `json:"kind"`
+	Exp       int64  `json:"exp"`
+}
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+// newToken 生成JWT格式的令牌，测试服务不校验签名
+func newToken(c tokenClaims) string {
+	b, _ := json.Marshal(c)
+	return tokenHeader + "." + base64.RawURLEncoding.EncodeToString(b) + ".dgraphtest"
+}
+
+func parseToken(token, kind string) (tokenClaims, error) {
+	var c tokenClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return c, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return c, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if err = json.Unmarshal(b, &c); err != nil || c.Kind != kind {
+		return c, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if time.Now().Unix() >= c.Exp {
+		return c, status.Error(codes.Unauthenticated, "Token is expired")
+	}
+	return c, nil
+}
+
+// authorize 开启ACL时校验请求携带的 access token
+func (s *Server) authorize(ctx context.Context) error {
+	if len(s.users) == 0 {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get("accessJwt")
+	if len(tokens) == 0 {
+		return status.Error(codes.Unauthenticated, "no accessJwt available")
+	}
+	_, err := parseToken(tokens[0], "access")
+	return err
+}
@@ -0,0 +1,281 @@
+package dgraphtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"github.com/golang-common/dgraph/dgraphtest"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `
+name: string @index(exact, term) @lang .
+age: int @index(int) .
+friend: [uid] @reverse .
+owner: uid .
+type Person {
+	name
+	age
+	friend
+}
+type Pet {
+	name
+	owner
+}
+`
+
+const testData = `
+_:alice <name> "Alice" .
+_:alice <name> "Alicia"@es .
+_:alice <age> "30" .
+_:alice <friend> _:bob .
+_:alice <friend> _:carol .
+_:alice <dgraph.type> "Person" .
+_:bob <name> "Bob" .
+_:bob <age> "25" .
+_:bob <dgraph.type> "Person" .
+_:carol <name> "Carol" .
+_:carol <dgraph.type> "Person" .
+_:rex <name> "Rex" .
+_:rex <owner> _:bob .
+_:rex <dgraph.type> "Pet" .
+`
+
+// newClient 启动测试服务并通过 dgraph.NewClient 连接，写入测试schema和数据，返回空白节点对应的UID
+func newClient(t *testing.T) (*dgraph.Client, map[string]string) {
+	t.Helper()
+	s := dgraphtest.NewServer()
+	t.Cleanup(s.Close)
+	client, err := dgraph.NewClient([]string{dgraphtest.Target}, dgraph.WithContextDialer(s.Dialer()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	ctx := context.Background()
+	if err = client.Alter(ctx, &api.Operation{Schema: testSchema}); err != nil {
+		t.Fatalf("Alter: %v", err)
+	}
+	resp, err := client.Txn(false).Mutate(ctx, &api.Mutation{SetNquads: []byte(testData), CommitNow: true})
+	if err != nil {
+		t.Fatalf("Mutate: %v", err)
+	}
+	return client, resp.Uids
+}
+
+// assertJSON 比较查询结果与期望的JSON，忽略键的顺序
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid response %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expectation %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func query(t *testing.T, client *dgraph.Client, q string, vars map[string]string) []byte {
+	t.Helper()
+	resp, err := client.Txn(true).QueryWithVars(context.Background(), q, vars)
+	if err != nil {
+		t.Fatalf("query %s: %v", q, err)
+	}
+	return resp.Json
+}
+
+func TestQuery(t *testing.T) {
+	client, uids := newClient(t)
+	tests := []struct {
+		name string
+		q    string
+		vars map[string]string
+		want string
+	}{
+		{
+			name: "uid",
+			q:    `query q($a: string) { q(func: uid($a)) { name age } }`,
+			vars: map[string]string{"$a": uids["alice"]},
+			want: `{"q": [{"name": "Alice", "age": 30}]}`,
+		},
+		{
+			name: "eq",
+			q:    `{ q(func: eq(name, "Bob")) { name age } }`,
+			want: `{"q": [{"name": "Bob", "age": 25}]}`,
+		},
+		{
+			name: "eq list",
+			q:    `{ q(func: eq(age, [25, 30]), orderasc: age) { name } }`,
+			want: `{"q": [{"name": "Bob"}, {"name": "Alice"}]}`,
+		},
+		{
+			name: "has",
+			q:    `{ q(func: has(owner)) { name } }`,
+			want: `{"q": [{"name": "Rex"}]}`,
+		},
+		{
+			name: "type",
+			q:    `{ q(func: type(Person), orderasc: name) { name } }`,
+			want: `{"q": [{"name": "Alice"}, {"name": "Bob"}, {"name": "Carol"}]}`,
+		},
+		{
+			name: "filter",
+			q:    `{ q(func: type(Person), orderasc: name) @filter(ge(age, 26) OR NOT has(age)) { name } }`,
+			want: `{"q": [{"name": "Alice"}, {"name": "Carol"}]}`,
+		},
+		{
+			name: "nested edges",
+			q:    `{ q(func: eq(name, "Alice")) { name friend (orderasc: name) { name } } }`,
+			want: `{"q": [{"name": "Alice", "friend": [{"name": "Bob"}, {"name": "Carol"}]}]}`,
+		},
+		{
+			name: "single uid edge",
+			q:    `{ q(func: eq(name, "Rex")) { owner { name } } }`,
+			want: `{"q": [{"owner": {"name": "Bob"}}]}`,
+		},
+		{
+			name: "reverse edge",
+			q:    `{ q(func: eq(name, "Bob")) { ~friend { name } } }`,
+			want: `{"q": [{"~friend": [{"name": "Alice"}]}]}`,
+		},
+		{
+			name: "language",
+			q:    `{ q(func: eq(name@es, "Alicia")) { name@es name@fr:. } }`,
+			want: `{"q": [{"name@es": "Alicia", "name@fr:.": "Alice"}]}`,
+		},
+		{
+			name: "no match",
+			q:    `{ q(func: eq(name, "Nobody")) { name } }`,
+			want: `{"q": []}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSON(t, query(t, client, tt.q, tt.vars), tt.want)
+		})
+	}
+}
+
+func TestSchemaQuery(t *testing.T) {
+	client, _ := newClient(t)
+	s, err := client.Txn(true).Schema(context.Background())
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	preds := make(map[string]dgraph.SchemaPred)
+	for _, p := range s.Preds {
+		preds[p.Name] = p
+	}
+	want := map[string]dgraph.SchemaPred{
+		"name":   {Name: "name", Type: dgraph.TypeString, Index: true, Tokens: []string{"exact", "term"}, Lang: true},
+		"age":    {Name: "age", Type: dgraph.TypeInt, Index: true, Tokens: []string{"int"}},
+		"friend": {Name: "friend", Type: dgraph.TypeUid, List: true, Reverse: true},
+		"owner":  {Name: "owner", Type: dgraph.TypeUid},
+	}
+	for name, w := range want {
+		got, ok := preds[name]
+		if !ok {
+			t.Errorf("predicate %s missing from schema{}", name)
+			continue
+		}
+		if len(got.Tokens) == 0 {
+			got.Tokens = nil
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("predicate %s: got %+v, want %+v", name, got, w)
+		}
+	}
+	typ, err := client.Txn(true).SchemaType(context.Background(), "Pet")
+	if err != nil {
+		t.Fatalf("SchemaType: %v", err)
+	}
+	if typ.Name != "Pet" || len(typ.Fields) != 2 {
+		t.Errorf("type Pet: got %+v", typ)
+	}
+}
+
+func TestDeleteAndUpsert(t *testing.T) {
+	client, uids := newClient(t)
+	ctx := context.Background()
+	del := &api.Mutation{
+		DelNquads: []byte("<" + uids["alice"] + "> <friend> <" + uids["bob"] + "> .\n<" + uids["bob"] + "> <age> * ."),
+		CommitNow: true,
+	}
+	if _, err := client.Txn(false).Mutate(ctx, del); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	assertJSON(t, query(t, client, `{ q(func: eq(name, "Alice")) { friend { name } } }`, nil),
+		`{"q": [{"friend": [{"name": "Carol"}]}]}`)
+	assertJSON(t, query(t, client, `{ q(func: eq(name, "Bob")) { name age } }`, nil),
+		`{"q": [{"name": "Bob"}]}`)
+
+	// 条件不满足的变更不执行
+	req := &api.Request{
+		Query: `{ v as var(func: eq(name, "Bob")) }`,
+		Mutations: []*api.Mutation{
+			{Cond: `@if(eq(len(v), 0))`, SetNquads: []byte(`_:x <name> "Bob" .`)},
+			{Cond: `@if(eq(len(v), 1))`, SetNquads: []byte(`uid(v) <age> "26" .`)},
+		},
+		CommitNow: true,
+	}
+	resp, err := client.Txn(false).Do(ctx, req)
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if len(resp.Uids) != 0 {
+		t.Errorf("conditional set should not fire, got uids %v", resp.Uids)
+	}
+	assertJSON(t, query(t, client, `{ q(func: eq(name, "Bob")) { name age } }`, nil),
+		`{"q": [{"name": "Bob", "age": 26}]}`)
+}
+
+func TestTxnConflict(t *testing.T) {
+	client, uids := newClient(t)
+	ctx := context.Background()
+	set := []byte("<" + uids["bob"] + "> <age> \"40\" .")
+	t1, t2 := client.Txn(false), client.Txn(false)
+	if _, err := t1.Mutate(ctx, &api.Mutation{SetNquads: set}); err != nil {
+		t.Fatalf("t1 mutate: %v", err)
+	}
+	if _, err := t2.Mutate(ctx, &api.Mutation{SetNquads: set}); err != nil {
+		t.Fatalf("t2 mutate: %v", err)
+	}
+	if err := t1.Commit(ctx); err != nil {
+		t.Fatalf("t1 commit: %v", err)
+	}
+	err := t2.Commit(ctx)
+	if !errors.Is(err, dgo.ErrAborted) {
+		t.Fatalf("t2 commit: got %v, want %v", err, dgo.ErrAborted)
+	}
+	if !dgraph.IsAborted(err) {
+		t.Errorf("IsAborted(%v) = false", err)
+	}
+}
+
+func TestACL(t *testing.T) {
+	s := dgraphtest.NewServer(dgraphtest.WithUser("groot", "password"))
+	defer s.Close()
+	ctx := context.Background()
+	anonymous, err := s.Client()
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	defer anonymous.Close()
+	if _, err = anonymous.Txn(true).Query(ctx, `schema{}`); !dgraph.IsUnauthorized(err) {
+		t.Errorf("query without login: got %v, want unauthorized", err)
+	}
+	client, err := s.Client(dgraph.WithAuth("groot", "password", 0))
+	if err != nil {
+		t.Fatalf("Client with auth: %v", err)
+	}
+	defer client.Close()
+	if _, err = client.Txn(true).Query(ctx, `schema{}`); err != nil {
+		t.Errorf("query after login: %v", err)
+	}
+}
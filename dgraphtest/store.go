@@ -0,0 +1,354 @@
+package dgraphtest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const typePred = "dgraph.type"
+
+// value 谓词的单个值或边
+// uid 非零时表示指向节点 uid 的边，否则 val 为值，类型为 string、int64、float64、bool、time.Time 或 geo 的 json.RawMessage
+type value struct {
+	uid    uint64
+	val    any
+	lang   string
+	facets map[string]any
+}
+
+func (v value) equal(o value) bool {
+	if v.uid != 0 || o.uid != 0 {
+		return v.uid == o.uid
+	}
+	if v.lang != o.lang {
+		return false
+	}
+	if a, ok := v.val.(json.RawMessage); ok {
+		b, ok := o.val.(json.RawMessage)
+		return ok && string(a) == string(b)
+	}
+	if a, ok := v.val.(time.Time); ok {
+		b, ok := o.val.(time.Time)
+		return ok && a.Equal(b)
+	}
+	return v.val == o.val
+}
+
+// node 节点，key 为谓词名称
+type node map[string][]value
+
+// store 内存中的图数据和schema
+type store struct {
+	preds   map[string]dgraph.SchemaPred
+	types   map[string]dgraph.SchemaType
+	nodes   map[uint64]node
+	nextUid uint64
+}
+
+func newStore() *store {
+	s := &store{nextUid: 1}
+	s.reset()
+	return s
+}
+
+func (s *store) reset() {
+	s.preds = map[string]dgraph.SchemaPred{
+		typePred: {Name: typePred, Type: dgraph.TypeString, Index: true, Tokens: []string{"exact"}, List: true},
+	}
+	s.types = make(map[string]dgraph.SchemaType)
+	s.nodes = make(map[uint64]node)
+}
+
+// clone 深拷贝数据，用于事务的工作区
+func (s *store) clone() *store {
+	r := &store{
+		preds:   make(map[string]dgraph.SchemaPred, len(s.preds)),
+		types:   make(map[string]dgraph.SchemaType, len(s.types)),
+		nodes:   make(map[uint64]node, len(s.nodes)),
+		nextUid: s.nextUid,
+	}
+	for k, v := range s.preds {
+		r.preds[k] = v
+	}
+	for k, v := range s.types {
+		r.types[k] = v
+	}
+	for uid, n := range s.nodes {
+		c := make(node, len(n))
+		for pred, vals := range n {
+			c[pred] = append([]value(nil), vals...)
+		}
+		r.nodes[uid] = c
+	}
+	return r
+}
+
+// sortedUids 返回所有节点UID，升序
+func (s *store) sortedUids() []uint64 {
+	var r = make([]uint64, 0, len(s.nodes))
+	for uid := range s.nodes {
+		r = append(r, uid)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
+// alter 合并schema文本中的谓词和类型
+func (s *store) alter(text string) error {
+	schema, err := dgraph.ParseSchema(text)
+	if err != nil {
+		return err
+	}
+	for _, p := range schema.Preds {
+		s.preds[p.Name] = p
+	}
+	for _, t := range schema.Types {
+		s.types[t.Name] = t
+	}
+	return nil
+}
+
+// dropPred 删除谓词及其所有数据
+func (s *store) dropPred(name string) {
+	delete(s.preds, name)
+	for _, n := range s.nodes {
+		for key := range n {
+			if key == name || strings.HasPrefix(key, name+"@") {
+				delete(n, key)
+			}
+		}
+	}
+}
+
+// schemaJSON 返回 schema{} 查询结果，preds 和 types 为空时返回全部
+func (s *store) schemaJSON(preds, types []string) map[string]any {
+	var (
+		r         = make(map[string]any)
+		predList  []dgraph.SchemaPred
+		typeList  []dgraph.SchemaType
+		predNames = preds
+		typeNames = types
+	)
+	if len(preds) == 0 && len(types) == 0 {
+		for name := range s.preds {
+			predNames = append(predNames, name)
+		}
+		for name := range s.types {
+			typeNames = append(typeNames, name)
+		}
+		sort.Strings(predNames)
+		sort.Strings(typeNames)
+	}
+	for _, name := range predNames {
+		if p, ok := s.preds[name]; ok {
+			predList = append(predList, p)
+		}
+	}
+	for _, name := range typeNames {
+		if t, ok := s.types[name]; ok {
+			typeList = append(typeList, t)
+		}
+	}
+	if len(predList) > 0 {
+		r["schema"] = predList
+	}
+	if len(typeList) > 0 {
+		r["types"] = typeList
+	}
+	return r
+}
+
+// predType 返回谓词类型，未定义时返回空
+func (s *store) predType(name string) dgraph.PredType {
+	return s.preds[name].Type
+}
+
+// ensurePred 谓词未定义时按值自动创建，与dgraph行为一致
+func (s *store) ensurePred(name string, v value) {
+	if _, ok := s.preds[name]; ok {
+		return
+	}
+	p := dgraph.SchemaPred{Name: name, Type: dgraph.TypeDefault}
+	if v.uid != 0 {
+		p.Type = dgraph.TypeUid
+		p.List = true
+	}
+	s.preds[name] = p
+}
+
+// set 写入谓词值，列表谓词追加，非列表谓词覆盖同语言的值
+func (s *store) set(uid uint64, pred string, v value) {
+	n := s.nodes[uid]
+	if n == nil {
+		n = make(node)
+		s.nodes[uid] = n
+	}
+	s.ensurePred(pred, v)
+	if p := s.preds[pred]; !p.List {
+		var kept []value
+		for _, old := range n[pred] {
+			if old.lang != v.lang {
+				kept = append(kept, old)
+			}
+		}
+		n[pred] = append(kept, v)
+		return
+	}
+	for i, old := range n[pred] {
+		if old.equal(v) {
+			n[pred][i] = v
+			return
+		}
+	}
+	n[pred] = append(n[pred], v)
+}
+
+// del 删除谓词值，all 为 true 时删除谓词的所有值
+func (s *store) del(uid uint64, pred string, v value, all bool) {
+	n := s.nodes[uid]
+	if n == nil {
+		return
+	}
+	if all {
+		delete(n, pred)
+	} else {
+		var kept []value
+		for _, old := range n[pred] {
+			if !old.equal(v) {
+				kept = append(kept, old)
+			}
+		}
+		if len(kept) == 0 {
+			delete(n, pred)
+		} else {
+			n[pred] = kept
+		}
+	}
+	if len(n) == 0 {
+		delete(s.nodes, uid)
+	}
+}
+
+// convert 将 api.Value 转换为存储值，默认类型的值按谓词schema类型转换
+func (s *store) convert(pred string, v *api.Value) (any, error) {
+	switch val := v.GetVal().(type) {
+	case *api.Value_DefaultVal:
+		return convertString(s.predType(pred), val.DefaultVal)
+	case *api.Value_StrVal:
+		return convertString(s.predType(pred), val.StrVal)
+	case *api.Value_PasswordVal:
+		return val.PasswordVal, nil
+	case *api.Value_IntVal:
+		return val.IntVal, nil
+	case *api.Value_DoubleVal:
+		return val.DoubleVal, nil
+	case *api.Value_BoolVal:
+		return val.BoolVal, nil
+	case *api.Value_DatetimeVal:
+		var t time.Time
+		if err := t.UnmarshalBinary(val.DatetimeVal); err != nil {
+			return nil, err
+		}
+		return t, nil
+	case *api.Value_DateVal:
+		var t time.Time
+		if err := t.UnmarshalBinary(val.DateVal); err != nil {
+			return nil, err
+		}
+		return t, nil
+	case *api.Value_GeoVal:
+		return json.RawMessage(val.GeoVal), nil
+	case *api.Value_BytesVal:
+		return string(val.BytesVal), nil
+	}
+	return nil, fmt.Errorf("unsupported value %v for predicate %s", v, pred)
+}
+
+// convertString 将字符串按谓词类型转换
+func convertString(typ dgraph.PredType, s string) (any, error) {
+	switch typ {
+	case dgraph.TypeInt:
+		return strconv.ParseInt(s, 10, 64)
+	case dgraph.TypeFloat:
+		return strconv.ParseFloat(s, 64)
+	case dgraph.TypeBool:
+		return strconv.ParseBool(s)
+	case dgraph.TypeDatetime:
+		return parseTime(s)
+	case dgraph.TypeGeo:
+		return json.RawMessage(s), nil
+	}
+	return s, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range timeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// facetValue 解析边属性值
+func facetValue(f *api.Facet) (any, error) {
+	switch f.ValType {
+	case api.Facet_INT:
+		if len(f.Value) != 8 {
+			return nil, fmt.Errorf("invalid int facet %s", f.Key)
+		}
+		return int64(binary.LittleEndian.Uint64(f.Value)), nil
+	case api.Facet_FLOAT:
+		if len(f.Value) != 8 {
+			return nil, fmt.Errorf("invalid float facet %s", f.Key)
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(f.Value)), nil
+	case api.Facet_BOOL:
+		return strconv.ParseBool(string(f.Value))
+	case api.Facet_DATETIME:
+		// time.Time.String() 可能带有单调时钟读数 m=+0.1
+		t, _, _ := strings.Cut(string(f.Value), " m=")
+		return parseTime(t)
+	}
+	return string(f.Value), nil
+}
+
+// jsonValue 转换为查询结果中的JSON值
+func jsonValue(v any) any {
+	switch val := v.(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+func formatUid(uid uint64) string {
+	return fmt.Sprintf("0x%x", uid)
+}
+
+func parseUid(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("invalid uid %s", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
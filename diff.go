@@ -0,0 +1,223 @@
+package dgraph
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AttrChange 谓词单个属性的变更
+// Attr - 属性名称，如 type、list、tokenizer
+type AttrChange struct {
+	Attr string `json:"attr"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// PredDiff 发生变更的谓词
+type PredDiff struct {
+	Name    string       `json:"name"`
+	Old     SchemaPred   `json:"old"`
+	New     SchemaPred   `json:"new"`
+	Changes []AttrChange `json:"changes"`
+}
+
+// TypeDiff 发生变更的类型
+type TypeDiff struct {
+	Name          string     `json:"name"`
+	Old           SchemaType `json:"old"`
+	New           SchemaType `json:"new"`
+	AddedFields   []string   `json:"addedFields,omitempty"`
+	RemovedFields []string   `json:"removedFields,omitempty"`
+}
+
+// SchemaDiff 两个schema之间的差异，以原schema为基准
+type SchemaDiff struct {
+	AddedPreds    []SchemaPred `json:"addedPreds,omitempty"`
+	RemovedPreds  []SchemaPred `json:"removedPreds,omitempty"`
+	ModifiedPreds []PredDiff   `json:"modifiedPreds,omitempty"`
+	AddedTypes    []SchemaType `json:"addedTypes,omitempty"`
+	RemovedTypes  []SchemaType `json:"removedTypes,omitempty"`
+	ModifiedTypes []TypeDiff   `json:"modifiedTypes,omitempty"`
+}
+
+// Diff 比较当前schema与目标schema target，返回新增、删除和变更的谓词与类型
+func (s Schema) Diff(target Schema) SchemaDiff {
+	var (
+		r        SchemaDiff
+		oldPreds = make(map[string]SchemaPred, len(s.Preds))
+		newPreds = make(map[string]bool, len(target.Preds))
+		oldTypes = make(map[string]SchemaType, len(s.Types))
+		newTypes = make(map[string]bool, len(target.Types))
+	)
+	for _, p := range s.Preds {
+		oldPreds[p.Name] = p
+	}
+	for _, p := range target.Preds {
+		newPreds[p.Name] = true
+		old, ok := oldPreds[p.Name]
+		if !ok {
+			r.AddedPreds = append(r.AddedPreds, p)
+			continue
+		}
+		if changes := predChanges(old, p); len(changes) > 0 {
+			r.ModifiedPreds = append(r.ModifiedPreds, PredDiff{Name: p.Name, Old: old, New: p, Changes: changes})
+		}
+	}
+	for _, p := range s.Preds {
+		if !newPreds[p.Name] {
+			r.RemovedPreds = append(r.RemovedPreds, p)
+		}
+	}
+	for _, t := range s.Types {
+		oldTypes[t.Name] = t
+	}
+	for _, t := range target.Types {
+		newTypes[t.Name] = true
+		old, ok := oldTypes[t.Name]
+		if !ok {
+			r.AddedTypes = append(r.AddedTypes, t)
+			continue
+		}
+		added, removed := typeFieldChanges(old, t)
+		if len(added) > 0 || len(removed) > 0 {
+			r.ModifiedTypes = append(r.ModifiedTypes, TypeDiff{
+				Name: t.Name, Old: old, New: t, AddedFields: added, RemovedFields: removed,
+			})
+		}
+	}
+	for _, t := range s.Types {
+		if !newTypes[t.Name] {
+			r.RemovedTypes = append(r.RemovedTypes, t)
+		}
+	}
+	r.sort()
+	return r
+}
+
+func (d *SchemaDiff) sort() {
+	sort.Slice(d.AddedPreds, func(i, j int) bool { return d.AddedPreds[i].Name < d.AddedPreds[j].Name })
+	sort.Slice(d.RemovedPreds, func(i, j int) bool { return d.RemovedPreds[i].Name < d.RemovedPreds[j].Name })
+	sort.Slice(d.ModifiedPreds, func(i, j int) bool { return d.ModifiedPreds[i].Name < d.ModifiedPreds[j].Name })
+	sort.Slice(d.AddedTypes, func(i, j int) bool { return d.AddedTypes[i].Name < d.AddedTypes[j].Name })
+	sort.Slice(d.RemovedTypes, func(i, j int) bool { return d.RemovedTypes[i].Name < d.RemovedTypes[j].Name })
+	sort.Slice(d.ModifiedTypes, func(i, j int) bool { return d.ModifiedTypes[i].Name < d.ModifiedTypes[j].Name })
+}
+
+// Empty 是否没有任何差异
+func (d SchemaDiff) Empty() bool {
+	return len(d.AddedPreds) == 0 && len(d.RemovedPreds) == 0 && len(d.ModifiedPreds) == 0 &&
+		len(d.AddedTypes) == 0 && len(d.RemovedTypes) == 0 && len(d.ModifiedTypes) == 0
+}
+
+// String 以 +(新增)、-(删除)、~(变更) 前缀逐行输出差异，用于人工审查
+func (d SchemaDiff) String() string {
+	var lines []string
+	for _, p := range d.AddedPreds {
+		lines = append(lines, "+ "+p.Rdf())
+	}
+	for _, p := range d.RemovedPreds {
+		lines = append(lines, "- "+p.Rdf())
+	}
+	for _, p := range d.ModifiedPreds {
+		var changes []string
+		for _, c := range p.Changes {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", c.Attr, c.Old, c.New))
+		}
+		lines = append(lines, fmt.Sprintf("~ %s (%s)", p.Name, strings.Join(changes, ", ")))
+	}
+	for _, t := range d.AddedTypes {
+		lines = append(lines, "+ type "+t.Name)
+	}
+	for _, t := range d.RemovedTypes {
+		lines = append(lines, "- type "+t.Name)
+	}
+	for _, t := range d.ModifiedTypes {
+		var changes []string
+		for _, f := range t.AddedFields {
+			changes = append(changes, "+"+f)
+		}
+		for _, f := range t.RemovedFields {
+			changes = append(changes, "-"+f)
+		}
+		lines = append(lines, fmt.Sprintf("~ type %s (%s)", t.Name, strings.Join(changes, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Rdf 生成使目标schema生效所需的schema语句，包括新增和变更的谓词与类型
+// 删除的谓词和类型需要通过 DropPred、DropType 单独处理
+func (d SchemaDiff) Rdf() string {
+	var lines []string
+	for _, p := range d.AddedPreds {
+		lines = append(lines, p.Rdf())
+	}
+	for _, p := range d.ModifiedPreds {
+		lines = append(lines, p.New.Rdf())
+	}
+	for _, t := range d.AddedTypes {
+		lines = append(lines, t.Rdf())
+	}
+	for _, t := range d.ModifiedTypes {
+		lines = append(lines, t.New.Rdf())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// predChanges 比较两个谓词的各项属性，返回发生变化的属性
+func predChanges(old, new SchemaPred) []AttrChange {
+	var r []AttrChange
+	add := func(attr, o, n string) {
+		if o != n {
+			r = append(r, AttrChange{Attr: attr, Old: o, New: n})
+		}
+	}
+	addBool := func(attr string, o, n bool) {
+		add(attr, strconv.FormatBool(o), strconv.FormatBool(n))
+	}
+	add("type", old.Type.String(), new.Type.String())
+	addBool("list", old.List, new.List)
+	addBool("index", old.Index, new.Index)
+	add("tokenizer", tokenString(old.Tokens), tokenString(new.Tokens))
+	addBool("reverse", old.Reverse, new.Reverse)
+	addBool("count", old.Count, new.Count)
+	addBool("upsert", old.Upsert, new.Upsert)
+	addBool("lang", old.Lang, new.Lang)
+	addBool("noconflict", old.NoConflict, new.NoConflict)
+	addBool("unique", old.UniqueIndex, new.UniqueIndex)
+	return r
+}
+
+// tokenString 将分词器列表排序后拼接，忽略顺序差异
+func tokenString(tokens []string) string {
+	var list = append([]string(nil), tokens...)
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// typeFieldChanges 返回新类型相比旧类型新增和删除的字段
+func typeFieldChanges(old, new SchemaType) ([]string, []string) {
+	var (
+		added, removed []string
+		oldFields      = make(map[string]bool, len(old.Fields))
+		newFields      = make(map[string]bool, len(new.Fields))
+	)
+	for _, f := range old.Fields {
+		oldFields[f.Name] = true
+	}
+	for _, f := range new.Fields {
+		newFields[f.Name] = true
+		if !oldFields[f.Name] {
+			added = append(added, f.Name)
+		}
+	}
+	for _, f := range old.Fields {
+		if !newFields[f.Name] {
+			removed = append(removed, f.Name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
@@ -0,0 +1,81 @@
+package dgraph_test
+
+import (
+	"context"
+	"github.com/golang-common/dgraph"
+	"strings"
+	"testing"
+)
+
+func TestSchemaDiff(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	base, err := dgraph.ParseSchema(`
+name: string @index(exact) .
+age: int .
+nick: string .
+type Person {
+	name
+	age
+	nick
+}
+type Legacy {
+	nick
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := dgraph.ParseSchema(`
+name: string @index(exact, term) .
+age: int .
+email: string @index(exact) .
+type Person {
+	name
+	age
+	email
+}
+type Company {
+	name
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.ApplySchema(ctx, base); err != nil {
+		t.Fatal(err)
+	}
+	live, err := client.Txn(true).Schema(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := live.Diff(base); !d.Empty() {
+		t.Fatalf("live schema should match the applied schema:\n%s", d)
+	}
+
+	d := live.Diff(target)
+	want := strings.Join([]string{
+		"+ email: string @index(exact) .",
+		"- nick: string  .",
+		"~ name (tokenizer: exact -> exact,term)",
+		"+ type Company",
+		"- type Legacy",
+		"~ type Person (+email, -nick)",
+	}, "\n")
+	if got := d.String(); got != want {
+		t.Errorf("String:\ngot\n%s\nwant\n%s", got, want)
+	}
+
+	// Rdf 只包含新增和变更，提交后再次比较只剩删除项
+	if err = client.ApplySchema(ctx, target, dgraph.WithDelta()); err != nil {
+		t.Fatal(err)
+	}
+	if live, err = client.Txn(true).Schema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d = live.Diff(target)
+	if len(d.AddedPreds) != 0 || len(d.ModifiedPreds) != 0 || len(d.AddedTypes) != 0 || len(d.ModifiedTypes) != 0 {
+		t.Errorf("delta apply left differences:\n%s", d)
+	}
+	if len(d.RemovedPreds) != 1 || d.RemovedPreds[0].Name != "nick" || len(d.RemovedTypes) != 1 || d.RemovedTypes[0].Name != "Legacy" {
+		t.Errorf("removed items should be kept: %+v", d)
+	}
+}
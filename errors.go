@@ -0,0 +1,179 @@
+package dgraph
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"strings"
+)
+
+// ErrNoMutation 变更没有处理任何数据，通常是upsert的条件不满足
+var ErrNoMutation = errors.New("no data was mutated, the mutation condition may not be satisfied")
+
+// ErrMutt 同 ErrNoMutation
+//
+// Deprecated: 使用 ErrNoMutation
+var ErrMutt = ErrNoMutation
+
+// ValidationError 类型定义或待写入的数据不合法
+// Type - 类型名称，Field - 结构体字段名，Pred - 谓词名称，无关的部分为空
+// Err 为导致校验失败的底层错误，如 *ConversionError
+type ValidationError struct {
+	Type  string
+	Field string
+	Pred  string
+	Msg   string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	msg := e.Msg
+	if e.Err != nil {
+		if msg == "" {
+			msg = e.Err.Error()
+		} else {
+			msg += ": " + e.Err.Error()
+		}
+	}
+	return withLocation(e.Type, e.Field, e.Pred, msg)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ConversionError Go值与谓词类型之间转换失败
+// Field、Pred - 结构体字段名和谓词名称，可能为空
+// Type - 谓词类型，GoType - Go值或结构体字段的类型，未知时为空
+type ConversionError struct {
+	Field  string
+	Pred   string
+	Type   PredType
+	GoType reflect.Type
+	Err    error
+}
+
+func (e *ConversionError) Error() string {
+	var msg string
+	switch {
+	case e.GoType != nil && e.Type != "":
+		msg = fmt.Sprintf("cannot convert between %s and predicate type %s", e.GoType, e.Type)
+	case e.GoType != nil:
+		msg = fmt.Sprintf("cannot convert %s", e.GoType)
+	case e.Type != "":
+		msg = fmt.Sprintf("cannot convert predicate type %s", e.Type)
+	default:
+		msg = "cannot convert value"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return withLocation("", e.Field, e.Pred, msg)
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaMismatchError 结构体字段与谓词定义不一致
+// Expected - 谓词定义的要求，Actual - 结构体字段的实际情况
+type SchemaMismatchError struct {
+	Type     string
+	Field    string
+	Pred     string
+	Expected string
+	Actual   string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return withLocation(e.Type, e.Field, e.Pred, fmt.Sprintf("schema mismatch, expected %s, got %s", e.Expected, e.Actual))
+}
+
+// withLocation 在错误信息前加上类型、字段和谓词
+func withLocation(typ, field, pred, msg string) string {
+	var parts []string
+	if typ != "" {
+		parts = append(parts, fmt.Sprintf("type [%s]", typ))
+	}
+	if field != "" {
+		parts = append(parts, "field "+field)
+	}
+	if pred != "" {
+		parts = append(parts, "predicate "+pred)
+	}
+	if len(parts) == 0 {
+		return msg
+	}
+	return strings.Join(parts, " ") + ": " + msg
+}
+
+// IsAborted 判断错误是否为事务冲突中止，可以重新执行事务
+func IsAborted(err error) bool {
+	return errors.Is(err, dgo.ErrAborted) || grpcCode(err) == codes.Aborted
+}
+
+// IsUnauthorized 判断错误是否为未登录、令牌失效或没有权限
+func IsUnauthorized(err error) bool {
+	code := grpcCode(err)
+	return code == codes.Unauthenticated || code == codes.PermissionDenied
+}
+
+// IsUnavailable 判断错误是否为alpha无法连接
+func IsUnavailable(err error) bool {
+	return grpcCode(err) == codes.Unavailable
+}
+
+// schemaConflicts Dgraph返回的与结构冲突相关的错误信息(小写)
+var schemaConflicts = []string{
+	"schema change not allowed",
+	"schema is already being modified",
+	"input for predicate",
+	"is not indexed",
+	"type mismatch",
+}
+
+// IsSchemaConflict 判断错误是否为结构冲突，包括服务端拒绝结构变更、写入值与谓词类型不符、
+// 查询的谓词缺少索引，以及本地检查出的 *SchemaMismatchError
+func IsSchemaConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	var mismatch *SchemaMismatchError
+	if errors.As(err, &mismatch) {
+		return true
+	}
+	s, ok := grpcStatus(err)
+	if !ok {
+		return false
+	}
+	msg := strings.ToLower(s.Message())
+	for _, sub := range schemaConflicts {
+		if strings.Contains(msg, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcStatus 从错误链中取出gRPC状态
+func grpcStatus(err error) (*status.Status, bool) {
+	var s interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &s) {
+		return s.GRPCStatus(), true
+	}
+	return nil, false
+}
+
+// grpcCode 返回错误链中的gRPC状态码，不是gRPC错误时返回 codes.Unknown
+func grpcCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if s, ok := grpcStatus(err); ok {
+		return s.Code()
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,93 @@
+package dgraph
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// LangAll 表示谓词的所有语言，map[string]string 字段自动使用，key 为语言标签，空字符串表示无语言标签的值
+const LangAll = "*"
+
+// WithLang 返回使用语言 lang 读写的谓词副本，lang 可以是 "en"、"zh:en:." 形式的语言列表
+func (p Pred) WithLang(lang string) Pred {
+	p.Lang = true
+	p.LangType = lang
+	return p
+}
+
+// QueryName 返回查询块中使用的谓词名称，指定了 LangType 时为 name@LangType，如 name@zh:.
+func (p Pred) QueryName() string {
+	return langKey(p.Name, p.LangType)
+}
+
+// writeLang 返回写入时使用的语言标签，即 LangType 中的第一个语言，"." 和 LangAll 表示不带语言标签
+func (p Pred) writeLang() string {
+	lang, _, _ := strings.Cut(p.LangType, ":")
+	if lang == "." || lang == LangAll {
+		return ""
+	}
+	return lang
+}
+
+// funcName 返回过滤函数和排序中使用的谓词名称，函数只支持单个语言，使用写入时的语言
+func (p Pred) funcName() string {
+	return langKey(p.Name, p.writeLang())
+}
+
+// langKey 返回带语言标签的谓词名称，也是查询结果JSON中的键
+func langKey(name, lang string) string {
+	if lang == "" {
+		return name
+	}
+	return name + "@" + lang
+}
+
+// isLangMap 判断字段类型是否为多语言值 map[string]string
+func isLangMap(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Map && typ.Key().Kind() == reflect.String && typ.Elem().Kind() == reflect.String
+}
+
+// checkLang 检查并补全谓词的语言设置，多语言值字段的 LangType 固定为 LangAll
+func checkLang(pred *Pred, typ reflect.Type) error {
+	if isLangMap(typ) {
+		if pred.LangType != "" && pred.LangType != LangAll {
+			return fmt.Errorf("map field cannot specify language %s", pred.LangType)
+		}
+		pred.Lang = true
+		pred.LangType = LangAll
+		return nil
+	}
+	if pred.LangType == "" {
+		return nil
+	}
+	if pred.LangType == LangAll || strings.Contains(pred.LangType, LangAll) {
+		return errors.New("language * requires a map[string]string field")
+	}
+	if pred.Type != TypeString && pred.Type != TypeDefault {
+		return errors.New("language requires a string predicate")
+	}
+	return nil
+}
+
+// fieldLang 返回字段的 LangType，fields 中没有该字段时(如嵌套结构体)从 db 标签解析
+func fieldLang(field reflect.StructField, fields map[string]Pred) string {
+	if pred, ok := fields[field.Name]; ok {
+		return pred.LangType
+	}
+	var pred Pred
+	if err := parseTag(&pred, field.Tag.Get(Db)); err != nil {
+		return ""
+	}
+	if pred.Type == "" {
+		pred.Type, _, _ = inferPredType(field.Type)
+	}
+	if err := checkLang(&pred, field.Type); err != nil {
+		return ""
+	}
+	return pred.LangType
+}
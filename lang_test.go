@@ -0,0 +1,95 @@
+package dgraph_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"reflect"
+	"testing"
+)
+
+type post struct {
+	Uid   string
+	Title string            `db:"post.title,index=exact,lang=en"`
+	Names map[string]string `db:"post.name"`
+}
+
+type fallbackPost struct {
+	Uid   string
+	Title string `db:"post.title,lang=fr:."`
+}
+
+func TestLanguageTags(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	typ := mustType[post](t, dgraph.WithTypeName("Post"))
+	applyTypes(t, client, typ)
+	posts := dgraph.NewRepository(client, typ)
+	p := &post{Title: "Hello", Names: map[string]string{"": "hello", "en": "Hello", "zh": "你好"}}
+	if err := posts.Create(ctx, p); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// 单语言字段写入 LangType 中的第一个语言，多语言值按 key 写入对应语言
+	resp, err := client.Txn(true).Query(ctx, "{ q(func: uid("+p.Uid+")) { post.title post.title@en post.name post.name@en post.name@zh } }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string][]map[string]string
+	if err = json.Unmarshal(resp.Json, &raw); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"post.title@en": "Hello", "post.name": "hello", "post.name@en": "Hello", "post.name@zh": "你好"}
+	if len(raw["q"]) != 1 || !reflect.DeepEqual(raw["q"][0], want) {
+		t.Errorf("stored values: got %s, want %v", resp.Json, want)
+	}
+
+	got, err := posts.Get(ctx, p.Uid)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Get: got %+v, want %+v", got, p)
+	}
+
+	// 过滤函数使用写入时的语言
+	title := typ.Fields["Title"]
+	q, err := dgraph.NewQuery(dgraph.NewBlock("q", dgraph.Eq(title, "Hello")).Uid()).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = client.Txn(true).Query(ctx, q); err != nil {
+		t.Fatalf("query %s: %v", q, err)
+	}
+	if string(resp.Json) != `{"q":[{"uid":"`+p.Uid+`"}]}` {
+		t.Errorf("filter by %s: got %s", title.QueryName(), resp.Json)
+	}
+
+	// 语言列表按顺序回退，"." 表示无语言标签的值
+	fallback := mustType[fallbackPost](t, dgraph.WithTypeName("Post"))
+	q = "{ q(func: uid(" + p.Uid + ")) {\n" + fallback.Selection() + "\n} }"
+	if resp, err = client.Txn(true).Query(ctx, q); err != nil {
+		t.Fatalf("query %s: %v", q, err)
+	}
+	list, err := fallback.Decode(resp.Json, "q")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	// 没有无语言标签的值时，"." 返回任意语言的值
+	if len(list) != 1 || list[0].Title != "Hello" {
+		t.Errorf("fallback to any language: got %+v", list)
+	}
+	if _, err = client.Txn(false).Mutate(ctx, &api.Mutation{
+		SetNquads: []byte("<" + p.Uid + "> <post.title> \"Bonjour\"@fr ."),
+		CommitNow: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = client.Txn(true).Query(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	if list, err = fallback.Decode(resp.Json, "q"); err != nil || len(list) != 1 || list[0].Title != "Bonjour" {
+		t.Errorf("fallback: got %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,98 @@
+package dgraph
+
+import (
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"reflect"
+)
+
+// MaskNquads 按字段掩码生成更新节点的N-Quad，mask 中为结构体字段名或谓词名称，不在掩码中的字段不会更新
+// 掩码中的字段即使是零值也会写入；nil指针、nil接口、空切片和空map会删除整个谓词；列表和多语言字段整体替换，先删除再写入
+// 返回写入和删除的N-Quad，应先执行删除；嵌套的新节点由 blanks 分配空白节点，blanks 为空时不写回UID
+// 掩码中的非空或主键字段被清空或为零值时返回 *ConstraintError
+func (t Type[T]) MaskNquads(uid string, data any, mask []string, blanks *BlankNodes) ([]*api.NQuad, []*api.NQuad, error) {
+	var (
+		set, del []*api.NQuad
+		err      error
+	)
+	if uid == "" {
+		return nil, nil, &ValidationError{Type: t.Name, Field: Uid, Msg: "empty uid value"}
+	}
+	masked, err := t.maskFields(mask)
+	if err != nil {
+		return nil, nil, err
+	}
+	if blanks == nil {
+		blanks = &BlankNodes{}
+	}
+	blanks.useTypes(t.nested)
+	eachField(reflect.ValueOf(data), func(field reflect.StructField, val reflect.Value) bool {
+		pred, ok := t.Fields[field.Name]
+		if !ok || !masked[field.Name] {
+			return true
+		}
+		star := &api.NQuad{Subject: uid, Predicate: pred.Name, ObjectValue: &api.Value{Val: &api.Value_DefaultVal{DefaultVal: StarAll}}}
+		notNull := pred.NotNull || pred.Pri
+		if isEmptyValue(val) {
+			if notNull {
+				err = &ConstraintError{Pred: pred.Name, Constraint: ConstraintNotNull}
+				return false
+			}
+			del = append(del, star)
+			return true
+		}
+		if notNull && val.IsZero() {
+			err = &ConstraintError{Pred: pred.Name, Constraint: ConstraintNotNull}
+			return false
+		}
+		if pred.List || val.Kind() == reflect.Map {
+			del = append(del, star)
+		}
+		var nquads []*api.NQuad
+		if nquads, err = fieldNquad(uid, pred, val, blanks); err != nil {
+			err = &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Err: err}
+			return false
+		}
+		set = append(set, nquads...)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return set, del, nil
+}
+
+// maskFields 将掩码转换为结构体字段名集合，掩码不匹配任何字段或谓词时返回错误
+func (t Type[T]) maskFields(mask []string) (map[string]bool, error) {
+	r := make(map[string]bool, len(mask))
+	for _, m := range mask {
+		if _, ok := t.Fields[m]; ok {
+			r[m] = true
+			continue
+		}
+		var found bool
+		for name, pred := range t.Fields {
+			if pred.Name == m {
+				r[name] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, &ValidationError{Type: t.Name, Msg: "field mask " + m + " matches no field or predicate"}
+		}
+	}
+	return r, nil
+}
+
+// isEmptyValue 判断掩码中的字段是否表示清空谓词，eachField 已经解开非nil的指针
+func isEmptyValue(val reflect.Value) bool {
+	if !val.IsValid() {
+		return true
+	}
+	switch val.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return val.IsNil()
+	case reflect.Slice, reflect.Map:
+		return val.Len() == 0
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package dgraph_test
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-common/dgraph"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateFields(t *testing.T) {
+	_, authors, _ := newLibrary(t)
+	ctx := context.Background()
+	alice := &author{Name: "Alice", Email: "alice@example.com", Age: 30, Tags: []string{"a", "b"},
+		Bio: map[string]string{"": "Poet", "fr": "Poète"}}
+	if err := authors.Create(ctx, alice); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	get := func() *author {
+		t.Helper()
+		got, err := authors.Get(ctx, alice.Uid)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		return got
+	}
+
+	// 掩码中的零值也会写入，掩码外的字段不变
+	if err := authors.UpdateFields(ctx, &author{Uid: alice.Uid, Age: 0, Tags: []string{"c"}}, "Age", "author.tags"); err != nil {
+		t.Fatalf("UpdateFields: %v", err)
+	}
+	got := get()
+	if got.Age != 0 || !reflect.DeepEqual(got.Tags, []string{"c"}) || got.Name != "Alice" || got.Email != alice.Email {
+		t.Errorf("UpdateFields: got %+v", got)
+	}
+
+	// nil 切片和 nil map 删除整个谓词，多语言值整体替换
+	if err := authors.UpdateFields(ctx, &author{Uid: alice.Uid, Bio: map[string]string{"de": "Dichterin"}}, "Tags", "Bio"); err != nil {
+		t.Fatalf("UpdateFields: %v", err)
+	}
+	got = get()
+	if len(got.Tags) != 0 || !reflect.DeepEqual(got.Bio, map[string]string{"de": "Dichterin"}) {
+		t.Errorf("UpdateFields clear and replace: got %+v", got)
+	}
+
+	var cerr *dgraph.ConstraintError
+	if err := authors.UpdateFields(ctx, &author{Uid: alice.Uid}, "Email"); !errors.As(err, &cerr) || cerr.Constraint != dgraph.ConstraintNotNull {
+		t.Errorf("clearing a notnull field: got %v, want not null violation", err)
+	}
+	if err := authors.UpdateFields(ctx, &author{Uid: alice.Uid, Name: "Bob"}, "Nickname"); err == nil {
+		t.Error("unknown mask should fail")
+	}
+	if got = get(); got.Email != alice.Email || got.Name != "Alice" {
+		t.Errorf("rejected updates should not write: got %+v", got)
+	}
+
+	bob := &author{Name: "Bob", Email: "bob@example.com"}
+	if err := authors.Create(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := authors.UpdateFields(ctx, &author{Uid: bob.Uid, Name: "Alice"}, "Name"); !errors.As(err, &cerr) || cerr.Uid != alice.Uid {
+		t.Errorf("masked duplicate: got %v, want unique conflict with %s", err, alice.Uid)
+	}
+}
@@ -0,0 +1,426 @@
+package dgraph
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"strings"
+	"time"
+)
+
+// 迁移记录使用的保留谓词和类型，Schema.SkipSysSchema 会忽略它们
+const (
+	MigrationPrefix   = "schema_migration."
+	MigrationType     = "SchemaMigration"
+	MigrationLockType = "SchemaMigrationLock"
+
+	migrationId       = MigrationPrefix + "id"
+	migrationDesc     = MigrationPrefix + "description"
+	migrationApplied  = MigrationPrefix + "applied_at"
+	migrationLock     = MigrationPrefix + "lock"
+	migrationOwner    = MigrationPrefix + "owner"
+	migrationLockedAt = MigrationPrefix + "locked_at"
+	migrationLockKey  = "lock"
+)
+
+var (
+	ErrMigrationLocked   = errors.New("migration is locked by another instance")
+	ErrMigrationLockLost = errors.New("migration lock expired or taken over by another instance")
+)
+
+// migrationSchema 迁移记录和迁移锁的schema
+var migrationSchema = Schema{
+	Preds: []SchemaPred{
+		{Name: migrationId, Type: TypeString, Index: true, Tokens: []string{"exact"}, Upsert: true},
+		{Name: migrationDesc, Type: TypeString},
+		{Name: migrationApplied, Type: TypeDatetime},
+		{Name: migrationLock, Type: TypeString, Index: true, Tokens: []string{"exact"}, Upsert: true},
+		{Name: migrationOwner, Type: TypeString},
+		{Name: migrationLockedAt, Type: TypeDatetime},
+	},
+	Types: []SchemaType{
+		{Name: MigrationType, Fields: []SchemaTypeField{{Name: migrationId}, {Name: migrationDesc}, {Name: migrationApplied}}},
+		{Name: MigrationLockType, Fields: []SchemaTypeField{{Name: migrationLock}, {Name: migrationOwner}, {Name: migrationLockedAt}}},
+	},
+}
+
+// Migration 版本化的schema迁移
+// ID - 迁移的唯一标识，已执行的迁移以此记录
+// Schema - 需要新增或修改的谓词和类型
+// DropPreds、DropTypes - 需要删除的谓词和类型，在 Schema 生效前执行
+// Up - 可选的数据迁移，在schema生效后执行
+type Migration struct {
+	ID          string
+	Description string
+	Schema      Schema
+	DropPreds   []string
+	DropTypes   []string
+	Up          func(ctx context.Context, client *Client) error
+}
+
+// Statements 返回迁移对应的DQL schema语句，删除操作以注释形式给出
+func (m Migration) Statements() string {
+	var lines = []string{fmt.Sprintf("# migration %s", m.ID)}
+	if m.Description != "" {
+		lines = append(lines, "# "+m.Description)
+	}
+	for _, t := range m.DropTypes {
+		lines = append(lines, "# drop type "+t)
+	}
+	for _, p := range m.DropPreds {
+		lines = append(lines, "# drop predicate "+p)
+	}
+	if rdf := m.Schema.Rdf(); rdf != "" {
+		lines = append(lines, rdf)
+	}
+	if m.Up != nil {
+		lines = append(lines, "# run data migration")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// AppliedMigration 已执行的迁移记录
+type AppliedMigration struct {
+	ID          string    `json:"schema_migration.id"`
+	Description string    `json:"schema_migration.description"`
+	AppliedAt   time.Time `json:"schema_migration.applied_at"`
+}
+
+// MigratorOption 迁移器的可选参数
+type MigratorOption func(m *Migrator)
+
+// WithLockTTL 设置迁移锁的过期时间，超过该时间未续期的锁可被其他实例抢占，默认10分钟，不大于0时忽略
+func WithLockTTL(ttl time.Duration) MigratorOption {
+	return func(m *Migrator) {
+		if ttl > 0 {
+			m.lockTTL = ttl
+		}
+	}
+}
+
+// Migrator 按注册顺序执行迁移，并在dgraph中记录已执行的迁移
+type Migrator struct {
+	client     *Client
+	migrations []Migration
+	lockTTL    time.Duration
+}
+
+// NewMigrator 创建迁移器
+func NewMigrator(client *Client, opts ...MigratorOption) *Migrator {
+	m := &Migrator{client: client, lockTTL: 10 * time.Minute}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Register 注册迁移，ID 为空或重复时返回错误
+func (m *Migrator) Register(migrations ...Migration) error {
+	for _, migration := range migrations {
+		if migration.ID == "" {
+			return errors.New("empty migration id")
+		}
+		for _, exist := range m.migrations {
+			if exist.ID == migration.ID {
+				return fmt.Errorf("duplicate migration id %s", migration.ID)
+			}
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	return nil
+}
+
+// Init 创建迁移记录所需的谓词和类型，可重复执行
+func (m *Migrator) Init(ctx context.Context) error {
+	return m.client.ApplySchema(ctx, migrationSchema)
+}
+
+// Applied 查询已执行的迁移
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	q := fmt.Sprintf("{\n%s(func: type(%s), orderasc: %s) {\n%s\n%s\n%s\n}\n}",
+		queryBlock, MigrationType, migrationApplied, migrationId, migrationDesc, migrationApplied)
+	resp, err := m.client.Txn(true).Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	var r map[string][]AppliedMigration
+	if err = json.Unmarshal(resp.Json, &r); err != nil {
+		return nil, err
+	}
+	return r[queryBlock], nil
+}
+
+// Pending 返回尚未执行的迁移
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done = make(map[string]bool, len(applied))
+	for _, a := range applied {
+		done[a.ID] = true
+	}
+	var r []Migration
+	for _, migration := range m.migrations {
+		if !done[migration.ID] {
+			r = append(r, migration)
+		}
+	}
+	return r, nil
+}
+
+// DryRun 返回待执行迁移的DQL schema语句，只读取迁移记录，不修改schema和数据
+// 尚未创建迁移记录的谓词和类型时，所有迁移都视为待执行
+func (m *Migrator) DryRun(ctx context.Context) (string, error) {
+	initialized, err := m.initialized(ctx)
+	if err != nil {
+		return "", err
+	}
+	pending := m.migrations
+	if initialized {
+		if pending, err = m.Pending(ctx); err != nil {
+			return "", err
+		}
+	}
+	var list []string
+	for _, migration := range pending {
+		list = append(list, migration.Statements())
+	}
+	return strings.Join(list, "\n\n"), nil
+}
+
+// initialized 判断迁移记录的谓词和类型是否已经创建
+func (m *Migrator) initialized(ctx context.Context) (bool, error) {
+	txn := m.client.Txn(true)
+	for _, name := range []string{migrationId, migrationApplied} {
+		pred, err := txn.SchemaPred(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		if pred.Name == "" {
+			return false, nil
+		}
+	}
+	typ, err := txn.SchemaType(ctx, MigrationType)
+	if err != nil {
+		return false, err
+	}
+	return typ.Name != "", nil
+}
+
+// Migrate 加锁后按顺序执行所有待执行的迁移，返回本次执行的迁移ID
+// 执行期间定期续期迁移锁，锁过期或被其他实例抢占时停止执行并返回 ErrMigrationLockLost
+// 其他实例持有迁移锁时返回 ErrMigrationLocked，释放锁失败时返回的错误包含该错误
+func (m *Migrator) Migrate(ctx context.Context) (applied []string, err error) {
+	if err = m.Init(ctx); err != nil {
+		return nil, err
+	}
+	owner, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	runCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.keepLock(runCtx, owner, cancel)
+	}()
+	defer func() {
+		cancel(nil)
+		<-done
+		if uerr := m.unlock(context.Background(), owner); uerr != nil {
+			err = errors.Join(err, fmt.Errorf("unlock migration, %w", uerr))
+		}
+	}()
+	pending, err := m.Pending(runCtx)
+	if err != nil {
+		return nil, lockErr(runCtx, err)
+	}
+	for _, migration := range pending {
+		if err = m.apply(runCtx, migration); err != nil {
+			return applied, fmt.Errorf("migration %s, %w", migration.ID, lockErr(runCtx, err))
+		}
+		applied = append(applied, migration.ID)
+		// 锁已失效时不再执行后续迁移
+		if cause := context.Cause(runCtx); errors.Is(cause, ErrMigrationLockLost) {
+			return applied, cause
+		}
+	}
+	return applied, nil
+}
+
+// lockErr 迁移因锁失效而被取消时返回 ErrMigrationLockLost，否则返回原错误
+func lockErr(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMigrationLockLost) {
+		return cause
+	}
+	return err
+}
+
+// minLockRenewInterval 迁移锁续期的最小间隔，避免 lockTTL 过小时续期过于频繁
+const minLockRenewInterval = time.Millisecond
+
+// keepLock 每隔 lockTTL 的三分之一(不小于 minLockRenewInterval)续期迁移锁，续期失败时以 ErrMigrationLockLost 取消 ctx
+func (m *Migrator) keepLock(ctx context.Context, owner string, cancel context.CancelCauseFunc) {
+	interval := m.lockTTL / 3
+	if interval < minLockRenewInterval {
+		interval = minLockRenewInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			held, err := m.renew(ctx, owner)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				cancel(fmt.Errorf("%w: %v", ErrMigrationLockLost, err))
+				return
+			}
+			if !held {
+				cancel(ErrMigrationLockLost)
+				return
+			}
+		}
+	}
+}
+
+// renew 续期本实例持有的迁移锁，返回是否仍持有该锁
+func (m *Migrator) renew(ctx context.Context, owner string) (bool, error) {
+	lockedAt, _, err := TypeDatetime.Value(time.Now())
+	if err != nil {
+		return false, err
+	}
+	var (
+		lockPred  = Pred{SchemaPred: SchemaPred{Name: migrationLock, Type: TypeString}}
+		ownerPred = Pred{SchemaPred: SchemaPred{Name: migrationOwner, Type: TypeString}}
+	)
+	u := NewUpsert(NewQuery(NewVarBlock(Eq(lockPred, migrationLockKey)).As("l").Filter(Eq(ownerPred, owner)))).
+		MutateIf(LenEq("l", 1), &api.Mutation{Set: []*api.NQuad{
+			{Subject: UidVar("l"), Predicate: migrationLockedAt, ObjectValue: lockedAt},
+		}})
+	r, err := m.client.Upsert(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return r.Fired[0], nil
+}
+
+// apply 执行单个迁移并写入迁移记录
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	for _, t := range migration.DropTypes {
+		if err := m.client.DropType(ctx, t); err != nil {
+			return err
+		}
+	}
+	for _, p := range migration.DropPreds {
+		if err := m.client.DropPred(ctx, p); err != nil {
+			return err
+		}
+	}
+	if err := m.client.ApplySchema(ctx, migration.Schema); err != nil {
+		return err
+	}
+	if migration.Up != nil {
+		if err := migration.Up(ctx, m.client); err != nil {
+			return err
+		}
+	}
+	const blank = "_:m"
+	nquads := []*api.NQuad{
+		strNquad(blank, migrationId, migration.ID),
+		strNquad(blank, "dgraph.type", MigrationType),
+	}
+	if migration.Description != "" {
+		nquads = append(nquads, strNquad(blank, migrationDesc, migration.Description))
+	}
+	applied, _, err := TypeDatetime.Value(time.Now())
+	if err != nil {
+		return err
+	}
+	nquads = append(nquads, &api.NQuad{Subject: blank, Predicate: migrationApplied, ObjectValue: applied})
+	return m.client.RunInTxn(ctx, func(txn *Txn) error {
+		_, err := txn.Mutate(ctx, &api.Mutation{Set: nquads})
+		return err
+	})
+}
+
+// lock 获取迁移锁，返回本实例的持有者标识
+func (m *Migrator) lock(ctx context.Context) (string, error) {
+	var b = make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	owner := hex.EncodeToString(b)
+	now := time.Now()
+	lockedAt, _, err := TypeDatetime.Value(now)
+	if err != nil {
+		return "", err
+	}
+	expired := now.Add(-m.lockTTL).Format(time.RFC3339Nano)
+	// 不存在锁时新建，锁已过期时抢占
+	q := fmt.Sprintf("{\nl as var(func: eq(%s, %s))\ne as var(func: uid(l)) @filter(lt(%s, %s))\n}",
+		migrationLock, quoteString(migrationLockKey), migrationLockedAt, quoteString(expired))
+	create := &api.Mutation{
+		Cond: "@if(eq(len(l), 0))",
+		Set: []*api.NQuad{
+			strNquad("_:lock", migrationLock, migrationLockKey),
+			strNquad("_:lock", migrationOwner, owner),
+			strNquad("_:lock", "dgraph.type", MigrationLockType),
+			{Subject: "_:lock", Predicate: migrationLockedAt, ObjectValue: lockedAt},
+		},
+	}
+	takeover := &api.Mutation{
+		Cond: "@if(eq(len(e), 1))",
+		Set: []*api.NQuad{
+			strNquad("uid(e)", migrationOwner, owner),
+			{Subject: "uid(e)", Predicate: migrationLockedAt, ObjectValue: lockedAt},
+		},
+	}
+	err = m.client.RunInTxn(ctx, func(txn *Txn) error {
+		_, err := txn.Do(ctx, &api.Request{Query: q, Mutations: []*api.Mutation{create, takeover}})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	// 提交后读取锁的持有者，确认是否加锁成功
+	resp, err := m.client.Txn(true).Query(ctx, fmt.Sprintf("{\n%s(func: eq(%s, %s)) {\n%s\n}\n}",
+		queryBlock, migrationLock, quoteString(migrationLockKey), migrationOwner))
+	if err != nil {
+		return "", err
+	}
+	var r map[string][]map[string]string
+	if err = json.Unmarshal(resp.Json, &r); err != nil {
+		return "", err
+	}
+	if locks := r[queryBlock]; len(locks) != 1 || locks[0][migrationOwner] != owner {
+		return "", ErrMigrationLocked
+	}
+	return owner, nil
+}
+
+// unlock 释放本实例持有的迁移锁
+func (m *Migrator) unlock(ctx context.Context, owner string) error {
+	q := fmt.Sprintf("{\nl as var(func: eq(%s, %s)) @filter(eq(%s, %s))\n}",
+		migrationLock, quoteString(migrationLockKey), migrationOwner, quoteString(owner))
+	return m.client.RunInTxn(ctx, func(txn *Txn) error {
+		_, err := txn.Do(ctx, &api.Request{Query: q, Mutations: []*api.Mutation{{
+			Cond: "@if(eq(len(l), 1))",
+			Del:  []*api.NQuad{{Subject: "uid(l)", Predicate: StarAll, ObjectValue: &api.Value{Val: &api.Value_DefaultVal{DefaultVal: StarAll}}}},
+		}}})
+		return err
+	})
+}
+
+func strNquad(subject, pred, val string) *api.NQuad {
+	return &api.NQuad{Subject: subject, Predicate: pred, ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: val}}}
+}
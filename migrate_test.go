@@ -0,0 +1,169 @@
+package dgraph_test
+
+import (
+	"context"
+	"errors"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrateOrder(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	var ran []string
+	up := func(id string) func(ctx context.Context, client *dgraph.Client) error {
+		return func(ctx context.Context, client *dgraph.Client) error {
+			ran = append(ran, id)
+			return nil
+		}
+	}
+	m := dgraph.NewMigrator(client)
+	err := m.Register(
+		dgraph.Migration{ID: "001", Description: "add name", Up: up("001"),
+			Schema: dgraph.Schema{Preds: []dgraph.SchemaPred{{Name: "name", Type: dgraph.TypeString}}}},
+		dgraph.Migration{ID: "002", Description: "index name", Up: up("002"),
+			Schema: dgraph.Schema{Preds: []dgraph.SchemaPred{{Name: "name", Type: dgraph.TypeString, Index: true, Tokens: []string{"exact"}}}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Register(dgraph.Migration{ID: "001"}); err == nil {
+		t.Error("duplicate id should be rejected")
+	}
+
+	// DryRun 不创建迁移记录的schema
+	plan, err := m.DryRun(ctx)
+	if err != nil {
+		t.Fatalf("DryRun: %v", err)
+	}
+	if !strings.Contains(plan, "# migration 001") || !strings.Contains(plan, "# migration 002") {
+		t.Errorf("DryRun should list both migrations:\n%s", plan)
+	}
+	pred, err := client.Txn(true).SchemaPred(ctx, dgraph.MigrationPrefix+"id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pred.Name != "" {
+		t.Errorf("DryRun created migration schema: %+v", pred)
+	}
+
+	applied, err := m.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if strings.Join(applied, ",") != "001,002" || strings.Join(ran, ",") != "001,002" {
+		t.Errorf("Migrate: applied %v, ran %v", applied, ran)
+	}
+	name, err := client.Txn(true).SchemaPred(ctx, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !name.Index {
+		t.Errorf("later migration should win: %+v", name)
+	}
+	records, err := m.Applied(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID != "001" || records[1].ID != "002" || records[0].Description != "add name" {
+		t.Errorf("Applied: %+v", records)
+	}
+
+	// 再次执行时只执行新注册的迁移
+	if err = m.Register(dgraph.Migration{ID: "003", Up: up("003")}); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = m.DryRun(ctx); err != nil || strings.Contains(plan, "001") || !strings.Contains(plan, "# migration 003") {
+		t.Errorf("DryRun after migrate: %v\n%s", err, plan)
+	}
+	if applied, err = m.Migrate(ctx); err != nil || strings.Join(applied, ",") != "003" {
+		t.Errorf("second Migrate: applied %v, err %v", applied, err)
+	}
+	if strings.Join(ran, ",") != "001,002,003" {
+		t.Errorf("ran %v", ran)
+	}
+}
+
+func TestMigrateLocked(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	var inner error
+	m := dgraph.NewMigrator(client)
+	err := m.Register(dgraph.Migration{ID: "001", Up: func(ctx context.Context, client *dgraph.Client) error {
+		other := dgraph.NewMigrator(client)
+		_ = other.Register(dgraph.Migration{ID: "002"})
+		_, inner = other.Migrate(ctx)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if !errors.Is(inner, dgraph.ErrMigrationLocked) {
+		t.Errorf("concurrent Migrate: got %v, want %v", inner, dgraph.ErrMigrationLocked)
+	}
+	// 锁释放后其他实例可以执行
+	other := dgraph.NewMigrator(client)
+	_ = other.Register(dgraph.Migration{ID: "002"})
+	if applied, err := other.Migrate(ctx); err != nil || len(applied) != 1 {
+		t.Errorf("Migrate after unlock: applied %v, err %v", applied, err)
+	}
+}
+
+func TestMigrateLockLost(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	var ranSecond bool
+	m := dgraph.NewMigrator(client, dgraph.WithLockTTL(30*time.Millisecond))
+	err := m.Register(
+		dgraph.Migration{ID: "001", Up: func(ctx context.Context, client *dgraph.Client) error {
+			// 模拟其他实例抢占迁移锁，续期失败后 ctx 被取消
+			_, err := client.Txn(false).Do(context.Background(), &api.Request{
+				Query: `{ l as var(func: eq(` + dgraph.MigrationPrefix + `lock, "lock")) }`,
+				Mutations: []*api.Mutation{{
+					SetNquads: []byte(`uid(l) <` + dgraph.MigrationPrefix + `owner> "other" .`),
+				}},
+				CommitNow: true,
+			})
+			if err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(2 * time.Second):
+				return errors.New("lock loss was not detected")
+			}
+		}},
+		dgraph.Migration{ID: "002", Up: func(ctx context.Context, client *dgraph.Client) error {
+			ranSecond = true
+			return nil
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := m.Migrate(ctx)
+	if !errors.Is(err, dgraph.ErrMigrationLockLost) {
+		t.Fatalf("Migrate: got %v, want %v", err, dgraph.ErrMigrationLockLost)
+	}
+	if len(applied) != 0 || ranSecond {
+		t.Errorf("no migration should be applied after the lock is lost: applied %v, ran second %t", applied, ranSecond)
+	}
+}
+
+func TestMigrateTinyLockTTL(t *testing.T) {
+	client := newTestClient(t)
+	m := dgraph.NewMigrator(client, dgraph.WithLockTTL(2*time.Nanosecond))
+	if err := m.Register(dgraph.Migration{ID: "001"}); err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := m.Migrate(context.Background()); err != nil || len(applied) != 1 {
+		t.Errorf("Migrate: applied %v, err %v", applied, err)
+	}
+}
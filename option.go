@@ -1,11 +1,45 @@
 package dgraph
 
+import (
+	"context"
+	"crypto/tls"
+	"google.golang.org/grpc"
+	"net"
+	"time"
+)
+
 type Option func(client *Client)
 
+// WithTls 使用TLS连接，certFile 为校验服务端证书的CA文件(为空时使用系统CA)，servname 为校验的服务端名称
+// CA文件修改后会在下次建立连接时重新加载
 func WithTls(certFile, servname string) Option {
 	return func(client *Client) {
-		client.certFile = certFile
-		client.servname = servname
+		client.tls.caFile = certFile
+		client.tls.servname = servname
+	}
+}
+
+// WithClientCert 使用客户端证书进行双向TLS认证，证书文件修改后会在下次建立连接时重新加载
+func WithClientCert(certFile, keyFile string) Option {
+	return func(client *Client) {
+		client.tls.certFile = certFile
+		client.tls.keyFile = keyFile
+	}
+}
+
+// WithTLSPEM 使用内存中的PEM证书，caPEM 为CA证书，certPEM 和 keyPEM 为客户端证书和私钥，不需要的部分传 nil
+func WithTLSPEM(caPEM, certPEM, keyPEM []byte) Option {
+	return func(client *Client) {
+		client.tls.caPEM = caPEM
+		client.tls.certPEM = certPEM
+		client.tls.keyPEM = keyPEM
+	}
+}
+
+// WithTLSConfig 使用完整的TLS配置，其他TLS选项会在其副本上继续生效
+func WithTLSConfig(config *tls.Config) Option {
+	return func(client *Client) {
+		client.tls.config = config
 	}
 }
 
@@ -15,4 +49,62 @@ func WithAuth(username, password string, namespace uint64) Option {
 		client.password = password
 		client.namespace = namespace
 	}
-}
\ No newline at end of file
+}
+
+// WithRetryPolicy 设置 RunInTxn 默认的事务冲突重试策略
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(client *Client) {
+		client.retry = policy
+	}
+}
+
+// WithContextDialer 使用自定义的拨号函数建立连接，例如连接进程内的测试服务
+func WithContextDialer(dialer func(ctx context.Context, addr string) (net.Conn, error)) Option {
+	return func(client *Client) {
+		client.dialer = dialer
+	}
+}
+
+// WithHealthCheck 每隔 interval 使用 CheckVersion 检查所有alpha，timeout 为单次检查的超时时间
+// 检查失败或请求返回 Unavailable 的alpha会被移出轮询，并按指数退避重新检查，恢复后重新加入
+func WithHealthCheck(interval, timeout time.Duration) Option {
+	return func(client *Client) {
+		client.healthInterval = interval
+		client.healthTimeout = timeout
+	}
+}
+
+// WithAuthHook 设置认证事件回调，登录、令牌刷新和重新登录时调用，fn 不应阻塞
+func WithAuthHook(fn func(event AuthEvent)) Option {
+	return func(client *Client) {
+		client.authHook = fn
+	}
+}
+
+// WithDialOptions 追加gRPC拨号选项，如 keepalive、压缩和 user-agent，在默认选项之后生效
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(client *Client) {
+		client.dialOptions = append(client.dialOptions, opts...)
+	}
+}
+
+// WithUnaryInterceptor 追加一元请求拦截器，多次调用时按添加顺序执行
+func WithUnaryInterceptor(interceptors ...grpc.UnaryClientInterceptor) Option {
+	return func(client *Client) {
+		client.interceptors = append(client.interceptors, interceptors...)
+	}
+}
+
+// WithMaxMessageSize 设置发送和接收的单条消息大小上限，小于等于0时使用 DefaultMaxMessageSize
+func WithMaxMessageSize(send, recv int) Option {
+	return func(client *Client) {
+		if send <= 0 {
+			send = DefaultMaxMessageSize
+		}
+		if recv <= 0 {
+			recv = DefaultMaxMessageSize
+		}
+		client.maxSendMsgSize = send
+		client.maxRecvMsgSize = recv
+	}
+}
@@ -0,0 +1,362 @@
+package dgraph
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError schema文本解析错误，Line 和 Col 从1开始
+type SyntaxError struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("schema syntax error at line %d, column %d: %s", e.Line, e.Col, e.Msg)
+}
+
+// ParseSchemaFile 读取并解析schema文件
+func ParseSchemaFile(path string) (Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Schema{}, err
+	}
+	return ParseSchema(string(b))
+}
+
+// ParseSchema 解析dgraph schema文本，支持谓词定义和 type 块，# 开头为注释
+func ParseSchema(text string) (Schema, error) {
+	p := &schemaParser{lex: schemaLexer{src: text, line: 1, col: 1}}
+	if err := p.next(); err != nil {
+		return Schema{}, err
+	}
+	var r Schema
+	for p.tok.kind != tokEOF {
+		if p.tok.kind == tokName && p.tok.val == "type" {
+			// type 也可能是谓词名称，以后续是否为冒号区分
+			save := *p
+			if err := p.next(); err != nil {
+				return Schema{}, err
+			}
+			if p.tok.kind != tokPunct || p.tok.val != ":" {
+				t, err := p.parseType()
+				if err != nil {
+					return Schema{}, err
+				}
+				r.Types = append(r.Types, t)
+				continue
+			}
+			*p = save
+		}
+		pred, err := p.parsePred()
+		if err != nil {
+			return Schema{}, err
+		}
+		r.Preds = append(r.Preds, pred)
+	}
+	return r, nil
+}
+
+const (
+	tokEOF = iota
+	tokName
+	tokPunct
+)
+
+type token struct {
+	kind      int
+	val       string
+	line, col int
+}
+
+type schemaLexer struct {
+	src       string
+	pos       int
+	line, col int
+}
+
+func (l *schemaLexer) errorf(line, col int, format string, args ...any) error {
+	return &SyntaxError{Line: line, Col: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *schemaLexer) peek() (rune, int) {
+	if l.pos >= len(l.src) {
+		return utf8.RuneError, 0
+	}
+	return utf8.DecodeRuneInString(l.src[l.pos:])
+}
+
+func (l *schemaLexer) advance() rune {
+	r, size := l.peek()
+	l.pos += size
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '~' || r == '-' || r == '/'
+}
+
+func (l *schemaLexer) next() (token, error) {
+	// 跳过空白和注释
+	for l.pos < len(l.src) {
+		r, _ := l.peek()
+		if r == '#' {
+			for l.pos < len(l.src) {
+				if r, _ = l.peek(); r == '\n' {
+					break
+				}
+				l.advance()
+			}
+			continue
+		}
+		if !unicode.IsSpace(r) {
+			break
+		}
+		l.advance()
+	}
+	tok := token{line: l.line, col: l.col}
+	if l.pos >= len(l.src) {
+		tok.kind = tokEOF
+		return tok, nil
+	}
+	r, _ := l.peek()
+	switch {
+	case r == '<':
+		l.advance()
+		start := l.pos
+		for {
+			if l.pos >= len(l.src) {
+				return tok, l.errorf(tok.line, tok.col, "unterminated <")
+			}
+			if c := l.advance(); c == '>' {
+				break
+			} else if c == '\n' {
+				return tok, l.errorf(tok.line, tok.col, "unterminated <")
+			}
+		}
+		tok.kind = tokName
+		tok.val = l.src[start : l.pos-1]
+		if tok.val == "" {
+			return tok, l.errorf(tok.line, tok.col, "empty predicate name")
+		}
+		return tok, nil
+	case isNameRune(r):
+		start := l.pos
+		for l.pos < len(l.src) {
+			c, size := l.peek()
+			if isNameRune(c) {
+				l.advance()
+				continue
+			}
+			// 名称中间允许出现点号，末尾的点号为语句结束符
+			if c == '.' && l.pos+size < len(l.src) {
+				if n, _ := utf8.DecodeRuneInString(l.src[l.pos+size:]); isNameRune(n) {
+					l.advance()
+					continue
+				}
+			}
+			break
+		}
+		tok.kind = tokName
+		tok.val = l.src[start:l.pos]
+		return tok, nil
+	case strings.ContainsRune(":[](){},@.", r):
+		l.advance()
+		tok.kind = tokPunct
+		tok.val = string(r)
+		return tok, nil
+	}
+	return tok, l.errorf(tok.line, tok.col, "unexpected character %q", r)
+}
+
+type schemaParser struct {
+	lex schemaLexer
+	tok token
+}
+
+func (p *schemaParser) next() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *schemaParser) errorf(format string, args ...any) error {
+	return p.lex.errorf(p.tok.line, p.tok.col, format, args...)
+}
+
+func (p *schemaParser) describe() string {
+	if p.tok.kind == tokEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", p.tok.val)
+}
+
+// expect 检查当前符号为 punct 并前进
+func (p *schemaParser) expect(punct string) error {
+	if p.tok.kind != tokPunct || p.tok.val != punct {
+		return p.errorf("expected %q, got %s", punct, p.describe())
+	}
+	return p.next()
+}
+
+func (p *schemaParser) name(what string) (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.errorf("expected %s, got %s", what, p.describe())
+	}
+	name := p.tok.val
+	return name, p.next()
+}
+
+var knownPredTypes = map[PredType]bool{
+	TypeDefault: true, TypeString: true, TypePassword: true, TypeBool: true, TypeInt: true,
+	TypeFloat: true, TypeDatetime: true, TypeGeo: true, TypeUid: true,
+}
+
+// parsePred 解析 name: type @directive ... .
+func (p *schemaParser) parsePred() (SchemaPred, error) {
+	var (
+		r   SchemaPred
+		err error
+	)
+	if r.Name, err = p.name("predicate name"); err != nil {
+		return r, err
+	}
+	if err = p.expect(":"); err != nil {
+		return r, err
+	}
+	if p.tok.kind == tokPunct && p.tok.val == "[" {
+		r.List = true
+		if err = p.next(); err != nil {
+			return r, err
+		}
+	}
+	line, col := p.tok.line, p.tok.col
+	typ, err := p.name("predicate type")
+	if err != nil {
+		return r, err
+	}
+	r.Type = PredType(typ)
+	if !knownPredTypes[r.Type] {
+		return r, p.lex.errorf(line, col, "unknown predicate type %q", typ)
+	}
+	if r.List {
+		if err = p.expect("]"); err != nil {
+			return r, err
+		}
+	}
+	for p.tok.kind == tokPunct && p.tok.val == "@" {
+		if err = p.next(); err != nil {
+			return r, err
+		}
+		line, col = p.tok.line, p.tok.col
+		directive, err := p.name("directive")
+		if err != nil {
+			return r, err
+		}
+		switch directive {
+		case "index":
+			if r.Tokens, err = p.parseTokens(); err != nil {
+				return r, err
+			}
+			r.Index = true
+		case "reverse":
+			r.Reverse = true
+		case "count":
+			r.Count = true
+		case "upsert":
+			r.Upsert = true
+		case "lang":
+			r.Lang = true
+		case "noconflict":
+			r.NoConflict = true
+		case "unique":
+			r.UniqueIndex = true
+		default:
+			return r, p.lex.errorf(line, col, "unknown directive @%s", directive)
+		}
+	}
+	if err = p.expect("."); err != nil {
+		return r, err
+	}
+	if r.Reverse && r.Type != TypeUid {
+		return r, p.lex.errorf(line, col, "@reverse is only allowed on uid predicate %s", r.Name)
+	}
+	return r, nil
+}
+
+// parseTokens 解析 @index 后的 (tok1, tok2)
+func (p *schemaParser) parseTokens() ([]string, error) {
+	var tokens []string
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		tok, err := p.name("tokenizer")
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if p.tok.kind == tokPunct && p.tok.val == "," {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		break
+	}
+	return tokens, p.expect(")")
+}
+
+// parseType 解析 type 关键字之后的 Name { field ... }
+func (p *schemaParser) parseType() (SchemaType, error) {
+	var (
+		r   SchemaType
+		err error
+	)
+	if r.Name, err = p.name("type name"); err != nil {
+		return r, err
+	}
+	if err = p.expect("{"); err != nil {
+		return r, err
+	}
+	for !(p.tok.kind == tokPunct && p.tok.val == "}") {
+		field, err := p.name("field name")
+		if err != nil {
+			return r, err
+		}
+		// 兼容旧语法 field: type
+		if p.tok.kind == tokPunct && p.tok.val == ":" {
+			if err = p.next(); err != nil {
+				return r, err
+			}
+			if p.tok.kind == tokPunct && p.tok.val == "[" {
+				if err = p.next(); err != nil {
+					return r, err
+				}
+				if _, err = p.name("field type"); err != nil {
+					return r, err
+				}
+				if err = p.expect("]"); err != nil {
+					return r, err
+				}
+			} else if _, err = p.name("field type"); err != nil {
+				return r, err
+			}
+		}
+		r.Fields = append(r.Fields, SchemaTypeField{Name: field})
+	}
+	return r, p.next()
+}
@@ -0,0 +1,251 @@
+package dgraph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TargetHealth 单个alpha的健康状态
+// Failures - 连续检查失败的次数，NextCheck 之前不再检查
+type TargetHealth struct {
+	Target    string
+	Healthy   bool
+	Version   string
+	LastCheck time.Time
+	NextCheck time.Time
+	LastError error
+	Failures  int
+}
+
+// alpha 到单个alpha的连接
+type alpha struct {
+	addr   string
+	conn   *grpc.ClientConn
+	client api.DgraphClient
+	health TargetHealth
+}
+
+// pool 实现 api.DgraphClient，在健康的alpha之间轮询
+// 开启健康检查后，不可用的alpha会被移出轮询，直到检查恢复
+type pool struct {
+	mu       sync.RWMutex
+	targets  []*alpha
+	next     uint64
+	closed   atomic.Bool
+	interval time.Duration
+	timeout  time.Duration
+	backoff  RetryPolicy
+}
+
+func newPool(targets []*alpha, interval, timeout time.Duration) *pool {
+	for _, t := range targets {
+		t.health = TargetHealth{Target: t.addr, Healthy: true}
+	}
+	return &pool{
+		targets:  targets,
+		interval: interval,
+		timeout:  timeout,
+		backoff:  RetryPolicy{BaseDelay: interval, MaxDelay: 16 * interval},
+	}
+}
+
+// pick 轮询选择健康的alpha，全部不健康时在所有alpha中轮询
+func (p *pool) pick(exclude *alpha) *alpha {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var candidates []*alpha
+	for _, t := range p.targets {
+		if t.health.Healthy && t != exclude {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, t := range p.targets {
+			if t != exclude {
+				candidates = append(candidates, t)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return exclude
+	}
+	n := atomic.AddUint64(&p.next, 1)
+	return candidates[n%uint64(len(candidates))]
+}
+
+// health 返回所有alpha的健康状态
+func (p *pool) health() []TargetHealth {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	r := make([]TargetHealth, 0, len(p.targets))
+	for _, t := range p.targets {
+		r = append(r, t.health)
+	}
+	return r
+}
+
+// close 标记连接池已关闭，之后的请求直接返回 ErrClientClosed
+func (p *pool) close() {
+	p.closed.Store(true)
+}
+
+// closeConns 关闭所有连接
+func (p *pool) closeConns() error {
+	var errs []error
+	for _, t := range p.targets {
+		if err := t.conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close %s: %w", t.addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// observe 根据请求结果更新状态，未开启健康检查时不改变状态
+func (p *pool) observe(t *alpha, err error) {
+	if p.interval <= 0 || status.Code(err) != codes.Unavailable {
+		return
+	}
+	p.markFailed(t, err, time.Now())
+}
+
+func (p *pool) markFailed(t *alpha, err error, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.health.Healthy = false
+	t.health.LastError = err
+	t.health.Failures++
+	t.health.NextCheck = now.Add(p.backoff.backoff(t.health.Failures))
+	// 跳过连接自身的重连等待，下次检查时立即重连
+	t.conn.ResetConnectBackoff()
+}
+
+// run 周期性检查所有alpha，直到 ctx 结束
+func (p *pool) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *pool) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	now := time.Now()
+	p.mu.RLock()
+	for _, t := range p.targets {
+		if now.Before(t.health.NextCheck) {
+			continue
+		}
+		wg.Add(1)
+		go func(t *alpha) {
+			defer wg.Done()
+			p.check(ctx, t)
+		}(t)
+	}
+	p.mu.RUnlock()
+	wg.Wait()
+}
+
+// check 使用 CheckVersion 检查alpha，未登录或无权限的错误说明服务可用
+func (p *pool) check(parent context.Context, t *alpha) {
+	ctx := parent
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, p.timeout)
+		defer cancel()
+	}
+	version, err := t.client.CheckVersion(ctx, &api.Check{})
+	now := time.Now()
+	switch status.Code(err) {
+	case codes.OK, codes.Unauthenticated, codes.PermissionDenied:
+	default:
+		// 客户端关闭导致的取消不计为失败
+		if parent.Err() == nil {
+			p.markFailed(t, err, now)
+		}
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.health.Healthy = true
+	t.health.Version = version.GetTag()
+	t.health.LastCheck = now
+	t.health.LastError = nil
+	t.health.Failures = 0
+	t.health.NextCheck = time.Time{}
+}
+
+// retryable 判断请求在连接不可用时能否换一个alpha重试，只有不修改数据的请求可以重试
+func retryable(err error, in any) bool {
+	if status.Code(err) != codes.Unavailable {
+		return false
+	}
+	switch req := in.(type) {
+	case *api.Request:
+		return len(req.Mutations) == 0
+	case *api.LoginRequest, *api.Check:
+		return true
+	}
+	return false
+}
+
+// call 在选中的alpha上执行请求，只读请求因连接不可用失败时换一个alpha重试一次
+func call[In, Out any](p *pool, in In, fn func(c api.DgraphClient) (Out, error)) (Out, error) {
+	if p.closed.Load() {
+		var zero Out
+		return zero, ErrClientClosed
+	}
+	t := p.pick(nil)
+	out, err := fn(t.client)
+	p.observe(t, err)
+	if err != nil && retryable(err, in) {
+		if other := p.pick(t); other != t {
+			out, err = fn(other.client)
+			p.observe(other, err)
+		}
+	}
+	return out, err
+}
+
+func (p *pool) Login(ctx context.Context, in *api.LoginRequest, opts ...grpc.CallOption) (*api.Response, error) {
+	return call(p, in, func(c api.DgraphClient) (*api.Response, error) {
+		return c.Login(ctx, in, opts...)
+	})
+}
+
+func (p *pool) Query(ctx context.Context, in *api.Request, opts ...grpc.CallOption) (*api.Response, error) {
+	return call(p, in, func(c api.DgraphClient) (*api.Response, error) {
+		return c.Query(ctx, in, opts...)
+	})
+}
+
+func (p *pool) Alter(ctx context.Context, in *api.Operation, opts ...grpc.CallOption) (*api.Payload, error) {
+	return call(p, in, func(c api.DgraphClient) (*api.Payload, error) {
+		return c.Alter(ctx, in, opts...)
+	})
+}
+
+func (p *pool) CommitOrAbort(ctx context.Context, in *api.TxnContext, opts ...grpc.CallOption) (*api.TxnContext, error) {
+	return call(p, in, func(c api.DgraphClient) (*api.TxnContext, error) {
+		return c.CommitOrAbort(ctx, in, opts...)
+	})
+}
+
+func (p *pool) CheckVersion(ctx context.Context, in *api.Check, opts ...grpc.CallOption) (*api.Version, error) {
+	return call(p, in, func(c api.DgraphClient) (*api.Version, error) {
+		return c.CheckVersion(ctx, in, opts...)
+	})
+}
@@ -2,11 +2,9 @@ package dgraph
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/dgraph-io/dgo/v210/protos/api"
-	"github.com/twpayne/go-geom"
-	"github.com/twpayne/go-geom/encoding/geojson"
-	"golang.org/x/crypto/bcrypt"
 	"math"
 	"reflect"
 	"strconv"
@@ -24,6 +22,7 @@ type Pred struct {
 	Pri      bool   // 主键约束(唯一 + 非空)
 	Unique   bool   // 唯一约束
 	NotNull  bool   // 非空约束
+	Cascade  string // 级联策略，由 db 标签的 cascade 选项指定，目前只支持 CascadeDelete
 }
 
 func (p Pred) String() string {
@@ -34,38 +33,18 @@ func (p Pred) Schema() SchemaPred {
 	return p.SchemaPred
 }
 
+// Nquad 将谓词值转换为N-Quad，值为没有UID的uid结构体时作为新节点递归转换，见 NquadBlank
 func (p Pred) Nquad(uid string, data any) ([]*api.NQuad, error) {
-	var (
-		r   []*api.NQuad
-		val = reflect.ValueOf(data)
-		typ = val.Type()
-	)
-	if typ.Kind() == reflect.Slice {
-		for i := 0; i < typ.Len(); i++ {
-			subVal := val.Index(i)
-			if !subVal.IsValid() || subVal.IsZero() {
-				continue
-			}
-			subNquad, err := p.singleNquad(uid, val.Index(i).Interface())
-			if err != nil {
-				return nil, err
-			}
-			r = append(r, subNquad)
-		}
-		return r, nil
-	}
-	if val.Kind() == reflect.Pointer {
-		val = val.Elem()
-	}
+	return p.NquadBlank(uid, data, &BlankNodes{})
+}
+
+// NquadBlank 同 Nquad，嵌套的新节点由 blanks 分配空白节点并添加 dgraph.type
+func (p Pred) NquadBlank(uid string, data any, blanks *BlankNodes) ([]*api.NQuad, error) {
+	val := reflect.ValueOf(data)
 	if !val.IsValid() || val.IsZero() {
-		return r, nil
+		return nil, nil
 	}
-	subNquad, err := p.singleNquad(uid, val.Interface())
-	if err != nil {
-		return nil, err
-	}
-	r = append(r, subNquad)
-	return r, nil
+	return fieldNquad(uid, p, val, blanks)
 }
 
 // QueryFilter 解析结构体单个值(去切片后)的过滤和边,start 参数表示是否为入口解析
@@ -78,12 +57,12 @@ func (p Pred) QueryFilter(data any) PredFilter {
 	switch p.Type {
 	case TypeString:
 		if p.List && val.Kind() == reflect.Slice && val.Len() > 0 {
-			r.MainFilter = fmt.Sprintf(`eq(%s,["%s"])`, p.Name, strings.Join(data.([]string), `","`))
+			r.MainFilter = fmt.Sprintf(`eq(%s,%s)`, p.funcName(), quoteStrings(val.Interface().([]string)))
 		}
 		if val.Kind() == reflect.String {
-			v := data.(string)
+			v := val.String()
 			if v != "" {
-				r.MainFilter = fmt.Sprintf(`eq(%s,"%s")`, p.Name, v)
+				r.MainFilter = fmt.Sprintf(`eq(%s,%s)`, p.funcName(), quoteString(v))
 			}
 		}
 	case TypeInt:
@@ -91,34 +70,34 @@ func (p Pred) QueryFilter(data any) PredFilter {
 			var rl []string
 			for i := 0; i < val.Len(); i++ {
 				sub := val.Index(i)
-				if val.CanInt() {
+				if sub.CanInt() {
 					rl = append(rl, fmt.Sprintf("%d", sub.Int()))
 				}
 			}
 			if len(rl) > 0 {
-				r.MainFilter = fmt.Sprintf(`eq(%s,[%s])`, p.Name, strings.Join(rl, ","))
+				r.MainFilter = fmt.Sprintf(`eq(%s,[%s])`, p.funcName(), strings.Join(rl, ","))
 			}
 		} else if val.CanInt() {
-			r.MainFilter = fmt.Sprintf("eq(%s,%d)", p.Name, val.Int())
+			r.MainFilter = fmt.Sprintf("eq(%s,%d)", p.funcName(), val.Int())
 		}
 	case TypeFloat:
 		if p.List && val.Kind() == reflect.Slice && val.Len() > 0 {
 			var rl []string
 			for i := 0; i < val.Len(); i++ {
 				sub := val.Index(i)
-				if val.CanFloat() {
-					rl = append(rl, fmt.Sprintf("%f", sub.Float()))
+				if sub.CanFloat() {
+					rl = append(rl, formatFloat(sub))
 				}
 			}
 			if len(rl) > 0 {
-				r.MainFilter = fmt.Sprintf(`eq(%s,[%s])`, p.Name, strings.Join(rl, ","))
+				r.MainFilter = fmt.Sprintf(`eq(%s,[%s])`, p.funcName(), strings.Join(rl, ","))
 			}
 		} else if val.CanFloat() {
-			r.MainFilter = fmt.Sprintf("eq(%s,%f)", p.Name, val.Float())
+			r.MainFilter = fmt.Sprintf("eq(%s,%s)", p.funcName(), formatFloat(val))
 		}
 	case TypeBool:
 		if val.Kind() == reflect.Bool {
-			r.MainFilter = fmt.Sprintf("eq(%s,%t)", p.Name, val.Bool())
+			r.MainFilter = fmt.Sprintf("eq(%s,%t)", p.funcName(), val.Bool())
 		}
 	case TypeUid:
 		if p.List && val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Struct && val.Len() > 0 {
@@ -128,7 +107,7 @@ func (p Pred) QueryFilter(data any) PredFilter {
 			break
 		}
 		// 主UID过滤项
-		if subId := val.FieldByName(Uid).String(); subId != "" {
+		if subId := val.FieldByName(Uid).String(); uidPattern.MatchString(subId) {
 			r.MainFilter = fmt.Sprintf("uid_in(%s,%s)", p.Name, subId)
 		}
 		// 边解析
@@ -148,21 +127,23 @@ func (p Pred) QueryFilter(data any) PredFilter {
 			var (
 				sok bool
 				sub = val.Field(i)
-				tag = val.Type().Field(i).Tag.Get(Db)
+				tag = dbTag(val.Type().Field(i))
 			)
-			sub, sok = checkAndElem(reflect.ValueOf(data))
+			sub, sok = checkAndElem(sub)
 			if !sok {
 				continue
 			}
 			if tag == "" || strings.Contains(tag, "|") {
 				continue
 			}
+			// 带语言标签的子谓词按写入时的语言过滤
+			tag = Pred{SchemaPred: SchemaPred{Name: tag}, LangType: fieldLang(val.Type().Field(i), nil)}.funcName()
 			sval := sub.Interface()
 			switch sval.(type) {
 			case string:
-				subFilterList = append(subFilterList, fmt.Sprintf(`eq(%s,%s)`, tag, sval.(string)))
+				subFilterList = append(subFilterList, fmt.Sprintf(`eq(%s,%s)`, tag, quoteString(sval.(string))))
 			case []string:
-				subFilterList = append(subFilterList, fmt.Sprintf(`eq(%s,["%s"])`, tag, strings.Join(sval.([]string), `","`)))
+				subFilterList = append(subFilterList, fmt.Sprintf(`eq(%s,%s)`, tag, quoteStrings(sval.([]string))))
 			case int, float64:
 				subFilterList = append(subFilterList, fmt.Sprintf(`eq(%s,%v)`, tag, sval))
 			case []int, []float64:
@@ -177,87 +158,6 @@ func (p Pred) QueryFilter(data any) PredFilter {
 	return r
 }
 
-// singleNquad 解析单个值
-func (p Pred) singleNquad(uid string, data any) (*api.NQuad, error) {
-	switch p.Type {
-	case "default":
-		if v, ok := data.(string); ok {
-			return &api.NQuad{Subject: uid, Predicate: p.Name, ObjectValue: &api.Value{Val: &api.Value_DefaultVal{DefaultVal: v}}}, nil
-		}
-		return nil, fmt.Errorf("error default value %v", data)
-	case "string":
-		if v, ok := data.(string); ok {
-			return &api.NQuad{Subject: uid, Predicate: p.Name, ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: v}}}, nil
-		}
-		return nil, fmt.Errorf("error string value %v", data)
-	case "password":
-		if v, ok := data.(string); ok {
-			b, err := bcrypt.GenerateFromPassword([]byte(v), bcrypt.MinCost)
-			if err != nil {
-				return nil, err
-			}
-			return &api.NQuad{Subject: uid, Predicate: p.Name, ObjectValue: &api.Value{Val: &api.Value_PasswordVal{PasswordVal: string(b)}}}, nil
-		}
-		return nil, fmt.Errorf("error password value %v", data)
-	case "int":
-		if v, ok := numToInt64(data); ok {
-			return &api.NQuad{Subject: uid, Predicate: p.Name, ObjectValue: &api.Value{Val: &api.Value_IntVal{IntVal: v}}}, nil
-		}
-		return nil, fmt.Errorf("error int value %v", data)
-	case "float":
-		if v, ok := data.(float32); ok {
-			return &api.NQuad{Subject: uid, Predicate: p.Name, ObjectValue: &api.Value{Val: &api.Value_DoubleVal{DoubleVal: float64(v)}}}, nil
-		}
-		if v, ok := data.(float64); ok {
-			return &api.NQuad{Subject: uid, Predicate: p.Name, ObjectValue: &api.Value{Val: &api.Value_DoubleVal{DoubleVal: v}}}, nil
-		}
-		return nil, fmt.Errorf("error float value %v", data)
-	case "datetime":
-		if v, ok := data.(time.Time); ok {
-			timeBinary, err := v.MarshalBinary()
-			if err != nil {
-				return nil, err
-			}
-			return &api.NQuad{Subject: uid, Predicate: p.Name, ObjectValue: &api.Value{Val: &api.Value_DatetimeVal{DatetimeVal: timeBinary}}}, nil
-		}
-		return nil, fmt.Errorf("error datetime value %v", data)
-	case "geo":
-		if v, ok := data.(geom.T); ok {
-			geomBinary, err := geojson.Marshal(v)
-			if err != nil {
-				return nil, err
-			}
-			return &api.NQuad{Subject: uid, Predicate: p.Name, ObjectValue: &api.Value{Val: &api.Value_GeoVal{GeoVal: geomBinary}}}, nil
-		}
-		return nil, fmt.Errorf("error geo value %v", data)
-	case "uid":
-		// 处理uid映射
-		var n api.NQuad
-		uidVal := reflect.ValueOf(data)
-		if uidVal.Kind() == reflect.Struct {
-			subId := uidVal.FieldByName(Uid).String()
-			if subId == "" {
-				return nil, fmt.Errorf("error uid value %v", data)
-			}
-			n = api.NQuad{Subject: uid, Predicate: p.Name, ObjectId: subId}
-		}
-		for k, facet := range p.Facets {
-			subval := uidVal.FieldByName(k)
-			if !subval.IsValid() || subval.IsZero() || subval.IsNil() {
-				continue
-			}
-			f, err := facet.Facet(subval.Interface())
-			if err != nil {
-				return nil, err
-			}
-			n.Facets = append(n.Facets, &f)
-		}
-		return &n, nil
-	default:
-		return nil, fmt.Errorf("error predicate type %s", p.Type)
-	}
-}
-
 type Facet struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
@@ -269,18 +169,28 @@ func (f Facet) QVal(data any) string {
 		return ""
 	}
 	switch f.Type {
-	case "string", "datetime":
-		return fmt.Sprintf(`eq(%s,"%s")`, f.Name, val.String())
+	case "string":
+		return fmt.Sprintf(`eq(%s,%s)`, f.Name, quoteString(val.String()))
+	case "datetime":
+		if v, ok := data.(time.Time); ok {
+			return fmt.Sprintf(`eq(%s,%s)`, f.Name, quoteString(v.Format(time.RFC3339Nano)))
+		}
+		return fmt.Sprintf(`eq(%s,%s)`, f.Name, quoteString(val.String()))
 	case "bool":
 		return fmt.Sprintf(`eq(%s,%t)`, f.Name, val.Bool())
 	case "int":
 		return fmt.Sprintf(`eq(%s,%d)`, f.Name, val.Int())
 	case "float":
-		return fmt.Sprintf(`eq(%s,%f)`, f.Name, val.Float())
+		return fmt.Sprintf(`eq(%s,%s)`, f.Name, formatFloat(val))
 	}
 	return ""
 }
 
+// formatFloat 按浮点数自身的精度输出最短的精确表示
+func formatFloat(val reflect.Value) string {
+	return strconv.FormatFloat(val.Float(), 'g', -1, val.Type().Bits())
+}
+
 func (f Facet) Facet(data any) (api.Facet, error) {
 	val := reflect.ValueOf(data)
 	switch data.(type) {
@@ -329,7 +239,7 @@ func (f Facet) Facet(data any) (api.Facet, error) {
 			ValType: api.Facet_DATETIME,
 		}, nil
 	default:
-		return api.Facet{}, fmt.Errorf("error facet datatype %s", val.Type())
+		return api.Facet{}, &ConversionError{Pred: f.Name, GoType: val.Type(), Err: errors.New("unsupported facet type")}
 	}
 }
 
@@ -0,0 +1,85 @@
+package dgraph_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"testing"
+)
+
+func TestQueryFilterEscaping(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	var (
+		name = dgraph.Pred{SchemaPred: dgraph.SchemaPred{Name: "name", Type: dgraph.TypeString, Index: true, Tokens: []string{"exact"}}}
+		age  = dgraph.Pred{SchemaPred: dgraph.SchemaPred{Name: "age", Type: dgraph.TypeInt, Index: true, Tokens: []string{"int"}}}
+		rate = dgraph.Pred{SchemaPred: dgraph.SchemaPred{Name: "rate", Type: dgraph.TypeFloat, Index: true, Tokens: []string{"float"}}}
+	)
+	if err := client.ApplySchema(ctx, dgraph.Schema{Preds: []dgraph.SchemaPred{name.SchemaPred, age.SchemaPred, rate.SchemaPred}}); err != nil {
+		t.Fatal(err)
+	}
+	values := []string{`say "hi"`, `back\slash`, "line\nbreak", `tab	}) OR has(age`}
+	var nquads []*api.NQuad
+	for i, v := range values {
+		subject := "_:n" + string(rune('a'+i))
+		nquads = append(nquads,
+			&api.NQuad{Subject: subject, Predicate: "name", ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: v}}},
+			&api.NQuad{Subject: subject, Predicate: "age", ObjectValue: &api.Value{Val: &api.Value_IntVal{IntVal: int64(20 + i)}}},
+			&api.NQuad{Subject: subject, Predicate: "rate", ObjectValue: &api.Value{Val: &api.Value_DoubleVal{DoubleVal: 0.1 + float64(i)}}},
+		)
+	}
+	if _, err := client.Txn(false).Mutate(ctx, &api.Mutation{Set: nquads, CommitNow: true}); err != nil {
+		t.Fatal(err)
+	}
+	matches := func(t *testing.T, filter string) []string {
+		t.Helper()
+		resp, err := client.Txn(true).Query(ctx, "{ q(func: has(name), orderasc: age) @filter("+filter+") { name } }")
+		if err != nil {
+			t.Fatalf("filter %s: %v", filter, err)
+		}
+		var r struct {
+			Q []struct {
+				Name string `json:"name"`
+			} `json:"q"`
+		}
+		if err = json.Unmarshal(resp.Json, &r); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, n := range r.Q {
+			names = append(names, n.Name)
+		}
+		return names
+	}
+	for _, v := range values {
+		t.Run(v, func(t *testing.T) {
+			filter := name.QueryFilter(v).MainFilter
+			if got := matches(t, filter); len(got) != 1 || got[0] != v {
+				t.Errorf("filter %s: got %q, want %q", filter, got, v)
+			}
+		})
+	}
+	t.Run("int list", func(t *testing.T) {
+		list := age
+		list.List = true
+		filter := list.QueryFilter([]int{20, 22}).MainFilter
+		if got := matches(t, filter); len(got) != 2 || got[0] != values[0] || got[1] != values[2] {
+			t.Errorf("filter %s: got %q", filter, got)
+		}
+	})
+	t.Run("float list", func(t *testing.T) {
+		list := rate
+		list.List = true
+		filter := list.QueryFilter([]float64{0.1, 3.1}).MainFilter
+		if got := matches(t, filter); len(got) != 2 || got[0] != values[0] || got[1] != values[3] {
+			t.Errorf("filter %s: got %q", filter, got)
+		}
+	})
+	t.Run("float", func(t *testing.T) {
+		filter := rate.QueryFilter(1.1).MainFilter
+		if got := matches(t, filter); len(got) != 1 || got[0] != values[1] {
+			t.Errorf("filter %s: got %q", filter, got)
+		}
+	})
+}
@@ -0,0 +1,575 @@
+package dgraph
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var varPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Filter 过滤条件，可作为 @filter 的内容，由函数或 And/Or/Not 组合而成
+type Filter interface {
+	filter() (string, error)
+}
+
+// Func DQL函数，可用于查询根(func:)或过滤条件
+type Func struct {
+	name string
+	args []string
+	err  error
+}
+
+func (f Func) filter() (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return fmt.Sprintf("%s(%s)", f.name, strings.Join(f.args, ", ")), nil
+}
+
+// String 返回函数的DQL表示，参数不合法时返回空字符串
+func (f Func) String() string {
+	s, _ := f.filter()
+	return s
+}
+
+func errFunc(name string, format string, args ...any) Func {
+	return Func{name: name, err: fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...))}
+}
+
+// checkTypes 检查谓词类型是否为 types 之一
+func checkTypes(fn string, pred Pred, types ...PredType) error {
+	for _, t := range types {
+		if pred.Type == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: predicate %s of type %s is not supported", fn, pred.Name, pred.Type)
+}
+
+// checkToken 检查谓词是否建立了函数所需的索引
+func checkToken(fn string, pred Pred, token string) error {
+	if pred.Index {
+		for _, t := range pred.Tokens {
+			if t == token {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s: predicate %s requires @index(%s)", fn, pred.Name, token)
+}
+
+// valueFunc 构建谓词加值参数的函数，值按谓词类型转换
+func valueFunc(name string, pred Pred, types []PredType, vals ...any) Func {
+	if err := checkTypes(name, pred, types...); err != nil {
+		return Func{name: name, err: err}
+	}
+	var args = []string{pred.funcName()}
+	for _, v := range vals {
+		q, err := queryLiteral(pred.Type, v)
+		if err != nil {
+			return errFunc(name, "predicate %s, %s", pred.Name, err)
+		}
+		args = append(args, q)
+	}
+	return Func{name: name, args: args}
+}
+
+// queryLiteral 将值按谓词类型转换为函数参数，与 PredType.QueryValue 不同，零值(0、false、"")也是合法参数
+// 浮点数使用最短的精确表示，切片转换为 [a, b] 形式
+func queryLiteral(typ PredType, data any) (string, error) {
+	val := reflect.ValueOf(data)
+	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return "", errors.New("nil value")
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return "", errors.New("nil value")
+	}
+	if val.Kind() == reflect.Slice {
+		if val.Len() == 0 {
+			return "", errors.New("empty value")
+		}
+		var list = make([]string, 0, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			q, err := queryLiteral(typ, val.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			list = append(list, q)
+		}
+		return fmt.Sprintf("[%s]", strings.Join(list, ", ")), nil
+	}
+	data = val.Interface()
+	switch typ {
+	case TypeString, TypeDefault:
+		if v, ok := data.(string); ok {
+			return quoteString(v), nil
+		}
+	case TypeInt:
+		if v, ok := numToInt64(data); ok {
+			return strconv.FormatInt(v, 10), nil
+		}
+	case TypeBool:
+		if v, ok := data.(bool); ok {
+			return strconv.FormatBool(v), nil
+		}
+	case TypeFloat:
+		switch v := data.(type) {
+		case float32:
+			return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		}
+	case TypeDatetime:
+		if v, ok := data.(time.Time); ok {
+			return quoteString(v.Format(time.RFC3339Nano)), nil
+		}
+	}
+	return "", &ConversionError{Type: typ, GoType: val.Type()}
+}
+
+// termFunc 构建需要特定索引的字符串匹配函数
+func termFunc(name, token string, pred Pred, text string) Func {
+	if err := checkTypes(name, pred, TypeString, TypeDefault); err != nil {
+		return Func{name: name, err: err}
+	}
+	if err := checkToken(name, pred, token); err != nil {
+		return Func{name: name, err: err}
+	}
+	return Func{name: name, args: []string{pred.funcName(), quoteString(text)}}
+}
+
+var (
+	comparableTypes = []PredType{TypeString, TypeDefault, TypeInt, TypeFloat, TypeDatetime}
+	eqTypes         = []PredType{TypeString, TypeDefault, TypeInt, TypeFloat, TypeDatetime, TypeBool}
+)
+
+// Eq 等于，传入多个值时匹配其中任意一个
+func Eq(pred Pred, vals ...any) Func {
+	if len(vals) == 0 {
+		return errFunc("eq", "predicate %s, no value", pred.Name)
+	}
+	if len(vals) == 1 {
+		return valueFunc("eq", pred, eqTypes, vals[0])
+	}
+	f := valueFunc("eq", pred, eqTypes, vals...)
+	if f.err == nil {
+		f.args = []string{f.args[0], fmt.Sprintf("[%s]", strings.Join(f.args[1:], ", "))}
+	}
+	return f
+}
+
+// Lt 小于
+func Lt(pred Pred, val any) Func {
+	return valueFunc("lt", pred, comparableTypes, val)
+}
+
+// Le 小于等于
+func Le(pred Pred, val any) Func {
+	return valueFunc("le", pred, comparableTypes, val)
+}
+
+// Gt 大于
+func Gt(pred Pred, val any) Func {
+	return valueFunc("gt", pred, comparableTypes, val)
+}
+
+// Ge 大于等于
+func Ge(pred Pred, val any) Func {
+	return valueFunc("ge", pred, comparableTypes, val)
+}
+
+// Between 在闭区间 [low, high] 内
+func Between(pred Pred, low, high any) Func {
+	return valueFunc("between", pred, comparableTypes, low, high)
+}
+
+// Has 节点存在该谓词
+func Has(pred Pred) Func {
+	return Func{name: "has", args: []string{pred.Name}}
+}
+
+// AnyOfTerms 包含任意一个词，需要 term 索引
+func AnyOfTerms(pred Pred, terms string) Func {
+	return termFunc("anyofterms", "term", pred, terms)
+}
+
+// AllOfTerms 包含所有词，需要 term 索引
+func AllOfTerms(pred Pred, terms string) Func {
+	return termFunc("allofterms", "term", pred, terms)
+}
+
+// AnyOfText 全文匹配任意一个词，需要 fulltext 索引
+func AnyOfText(pred Pred, text string) Func {
+	return termFunc("anyoftext", "fulltext", pred, text)
+}
+
+// AllOfText 全文匹配所有词，需要 fulltext 索引
+func AllOfText(pred Pred, text string) Func {
+	return termFunc("alloftext", "fulltext", pred, text)
+}
+
+// Regexp 正则匹配，flags 仅支持 "i"(忽略大小写)，需要 trigram 索引
+func Regexp(pred Pred, pattern, flags string) Func {
+	const name = "regexp"
+	if err := checkTypes(name, pred, TypeString, TypeDefault); err != nil {
+		return Func{name: name, err: err}
+	}
+	if err := checkToken(name, pred, "trigram"); err != nil {
+		return Func{name: name, err: err}
+	}
+	if flags != "" && flags != "i" {
+		return errFunc(name, "unsupported flags %s", flags)
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return errFunc(name, "predicate %s, %s", pred.Name, err)
+	}
+	return Func{name: name, args: []string{pred.funcName(), fmt.Sprintf("/%s/%s", escapeSlash(pattern), flags)}}
+}
+
+// escapeSlash 转义正则中未转义的 /，已转义的字符(如 \/)保持不变
+func escapeSlash(pattern string) string {
+	var (
+		b       strings.Builder
+		escaped bool
+	)
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '/':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Match 模糊匹配，distance 为最大编辑距离，需要 trigram 索引
+func Match(pred Pred, text string, distance int) Func {
+	f := termFunc("match", "trigram", pred, text)
+	if f.err == nil {
+		if distance < 0 {
+			return errFunc("match", "negative distance %d", distance)
+		}
+		f.args = append(f.args, fmt.Sprintf("%d", distance))
+	}
+	return f
+}
+
+// Uids 根据UID或UID变量查询
+func Uids(uids ...string) Func {
+	if len(uids) == 0 {
+		return errFunc("uid", "no uid value")
+	}
+	for _, uid := range uids {
+		if !uidPattern.MatchString(uid) && !varPattern.MatchString(uid) {
+			return errFunc("uid", "invalid uid value %s", uid)
+		}
+	}
+	return Func{name: "uid", args: uids}
+}
+
+// UidIn uid谓词指向指定节点
+func UidIn(pred Pred, uids ...string) Func {
+	const name = "uid_in"
+	if err := checkTypes(name, pred, TypeUid); err != nil {
+		return Func{name: name, err: err}
+	}
+	if len(uids) == 0 {
+		return errFunc(name, "predicate %s, no uid value", pred.Name)
+	}
+	for _, uid := range uids {
+		if !uidPattern.MatchString(uid) && !varPattern.MatchString(uid) {
+			return errFunc(name, "invalid uid value %s", uid)
+		}
+	}
+	arg := uids[0]
+	if len(uids) > 1 {
+		arg = fmt.Sprintf("[%s]", strings.Join(uids, ", "))
+	}
+	return Func{name: name, args: []string{pred.Name, arg}}
+}
+
+// OfType 节点的 dgraph.type 为 name
+func OfType(name string) Func {
+	if !varPattern.MatchString(name) {
+		return errFunc("type", "invalid type name %s", name)
+	}
+	return Func{name: "type", args: []string{name}}
+}
+
+type logical struct {
+	op      string
+	filters []Filter
+}
+
+func (l logical) filter() (string, error) {
+	if len(l.filters) == 0 {
+		return "", fmt.Errorf("%s: no filter", l.op)
+	}
+	var list = make([]string, 0, len(l.filters))
+	for _, f := range l.filters {
+		s, err := f.filter()
+		if err != nil {
+			return "", err
+		}
+		if _, ok := f.(logical); ok {
+			s = fmt.Sprintf("(%s)", s)
+		}
+		list = append(list, s)
+	}
+	if l.op == "NOT" {
+		return "NOT " + list[0], nil
+	}
+	return strings.Join(list, fmt.Sprintf(" %s ", l.op)), nil
+}
+
+// And 所有条件同时满足
+func And(filters ...Filter) Filter {
+	return logical{op: "AND", filters: filters}
+}
+
+// Or 满足任意一个条件
+func Or(filters ...Filter) Filter {
+	return logical{op: "OR", filters: filters}
+}
+
+// Not 条件取反
+func Not(filter Filter) Filter {
+	return logical{op: "NOT", filters: []Filter{filter}}
+}
+
+// Block 查询块，既可作为查询根块，也可作为嵌套的边
+type Block struct {
+	name   string
+	alias  string
+	root   *Func
+	filter Filter
+	params []string
+	fields []string
+	edges  []*Block
+	order  []int // 字段和边的输出顺序，非负为 fields 下标，负数为 edges 下标取反减一
+	err    error
+}
+
+// NewBlock 创建以 root 函数为入口的查询块
+func NewBlock(name string, root Func) *Block {
+	b := &Block{name: name, root: &root}
+	if !varPattern.MatchString(name) {
+		b.err = fmt.Errorf("invalid block name %s", name)
+	}
+	return b
+}
+
+// NewVarBlock 创建变量块 var(func: ...)，通常配合 As 或 UidAs 定义变量
+func NewVarBlock(root Func) *Block {
+	return &Block{name: "var", root: &root}
+}
+
+// NewEdge 创建对 uid 谓词展开的嵌套块
+func NewEdge(pred Pred) *Block {
+	b := &Block{name: pred.Name}
+	if pred.Type != TypeUid {
+		b.err = fmt.Errorf("edge: predicate %s of type %s is not uid", pred.Name, pred.Type)
+	}
+	if pred.Reversed && !strings.HasPrefix(pred.Name, "~") {
+		b.name = "~" + pred.Name
+	}
+	return b
+}
+
+func (b *Block) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// As 将块结果定义为变量 name
+func (b *Block) As(name string) *Block {
+	if !varPattern.MatchString(name) {
+		b.setErr(fmt.Errorf("invalid variable name %s", name))
+	}
+	b.alias = name
+	return b
+}
+
+// Filter 设置过滤条件
+func (b *Block) Filter(filter Filter) *Block {
+	b.filter = filter
+	return b
+}
+
+// First 返回前 n 个结果，n 为负数时返回最后 n 个
+func (b *Block) First(n int) *Block {
+	b.params = append(b.params, fmt.Sprintf("first: %d", n))
+	return b
+}
+
+// Offset 跳过前 n 个结果
+func (b *Block) Offset(n int) *Block {
+	if n < 0 {
+		b.setErr(fmt.Errorf("negative offset %d", n))
+	}
+	b.params = append(b.params, fmt.Sprintf("offset: %d", n))
+	return b
+}
+
+// After 返回 uid 大于 uid 的结果
+func (b *Block) After(uid string) *Block {
+	if !uidPattern.MatchString(uid) {
+		b.setErr(fmt.Errorf("invalid uid value %s", uid))
+	}
+	b.params = append(b.params, fmt.Sprintf("after: %s", uid))
+	return b
+}
+
+// OrderAsc 按谓词升序排列
+func (b *Block) OrderAsc(pred Pred) *Block {
+	b.setErr(checkTypes("orderasc", pred, comparableTypes...))
+	b.params = append(b.params, fmt.Sprintf("orderasc: %s", pred.funcName()))
+	return b
+}
+
+// OrderDesc 按谓词降序排列
+func (b *Block) OrderDesc(pred Pred) *Block {
+	b.setErr(checkTypes("orderdesc", pred, comparableTypes...))
+	b.params = append(b.params, fmt.Sprintf("orderdesc: %s", pred.funcName()))
+	return b
+}
+
+// Uid 输出节点 uid
+func (b *Block) Uid() *Block {
+	return b.field("uid")
+}
+
+// UidAs 将节点 uid 定义为变量 name
+func (b *Block) UidAs(name string) *Block {
+	if !varPattern.MatchString(name) {
+		b.setErr(fmt.Errorf("invalid variable name %s", name))
+	}
+	return b.field(fmt.Sprintf("%s as uid", name))
+}
+
+// Select 输出谓词值，uid 谓词应使用 Edge 展开
+func (b *Block) Select(preds ...Pred) *Block {
+	for _, p := range preds {
+		b.field(p.QueryName())
+	}
+	return b
+}
+
+// SelectAs 将谓词值定义为变量 name
+func (b *Block) SelectAs(name string, pred Pred) *Block {
+	if !varPattern.MatchString(name) {
+		b.setErr(fmt.Errorf("invalid variable name %s", name))
+	}
+	return b.field(fmt.Sprintf("%s as %s", name, pred.QueryName()))
+}
+
+// Expand 输出节点类型中的所有谓词
+func (b *Block) Expand() *Block {
+	return b.field("expand(_all_)")
+}
+
+// Edge 添加嵌套块
+func (b *Block) Edge(edges ...*Block) *Block {
+	for _, e := range edges {
+		b.order = append(b.order, -len(b.edges)-1)
+		b.edges = append(b.edges, e)
+	}
+	return b
+}
+
+func (b *Block) field(s string) *Block {
+	b.order = append(b.order, len(b.fields))
+	b.fields = append(b.fields, s)
+	return b
+}
+
+func (b *Block) build(sb *strings.Builder, depth int) error {
+	if b.err != nil {
+		return b.err
+	}
+	indent := strings.Repeat("\t", depth)
+	sb.WriteString(indent)
+	if b.alias != "" {
+		sb.WriteString(b.alias + " as ")
+	}
+	sb.WriteString(b.name)
+	var params []string
+	if b.root != nil {
+		root, err := b.root.filter()
+		if err != nil {
+			return err
+		}
+		params = append(params, "func: "+root)
+	}
+	params = append(params, b.params...)
+	if len(params) > 0 {
+		sb.WriteString(fmt.Sprintf("(%s)", strings.Join(params, ", ")))
+	}
+	if b.filter != nil {
+		f, err := b.filter.filter()
+		if err != nil {
+			return err
+		}
+		sb.WriteString(fmt.Sprintf(" @filter(%s)", f))
+	}
+	sb.WriteString(" {\n")
+	for _, i := range b.order {
+		if i >= 0 {
+			sb.WriteString(indent + "\t" + b.fields[i] + "\n")
+			continue
+		}
+		if err := b.edges[-i-1].build(sb, depth+1); err != nil {
+			return err
+		}
+	}
+	sb.WriteString(indent + "}\n")
+	return nil
+}
+
+// Query DQL查询，由一个或多个查询块组成
+type Query struct {
+	blocks []*Block
+}
+
+// NewQuery 创建查询
+func NewQuery(blocks ...*Block) *Query {
+	return &Query{blocks: blocks}
+}
+
+// Block 追加查询块
+func (q *Query) Block(blocks ...*Block) *Query {
+	q.blocks = append(q.blocks, blocks...)
+	return q
+}
+
+// Build 生成DQL查询语句，谓词类型或参数不合法时返回错误
+func (q *Query) Build() (string, error) {
+	if len(q.blocks) == 0 {
+		return "", fmt.Errorf("empty query")
+	}
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for _, b := range q.blocks {
+		if b.root == nil {
+			return "", fmt.Errorf("block %s has no root function", b.name)
+		}
+		if err := b.build(&sb, 1); err != nil {
+			return "", err
+		}
+	}
+	sb.WriteString("}")
+	return sb.String(), nil
+}
@@ -0,0 +1,136 @@
+package dgraph
+
+import (
+	"strings"
+	"testing"
+)
+
+var (
+	testName = Pred{SchemaPred: SchemaPred{Name: "name", Type: TypeString, Index: true, Tokens: []string{"exact", "term", "trigram"}}}
+	testAge  = Pred{SchemaPred: SchemaPred{Name: "age", Type: TypeInt}}
+	testRate = Pred{SchemaPred: SchemaPred{Name: "rate", Type: TypeFloat}}
+	testOn   = Pred{SchemaPred: SchemaPred{Name: "active", Type: TypeBool}}
+	testFri  = Pred{SchemaPred: SchemaPred{Name: "friend", Type: TypeUid, List: true}}
+)
+
+func TestFilterRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"eq string", Eq(testName, `a "b"`), `eq(name, "a \"b\"")`},
+		{"eq zero int", Eq(testAge, 0), `eq(age, 0)`},
+		{"eq false", Eq(testOn, false), `eq(active, false)`},
+		{"eq empty string", Eq(testName, ""), `eq(name, "")`},
+		{"eq many", Eq(testAge, 1, 2), `eq(age, [1, 2])`},
+		{"gt float", Gt(testRate, 0.1234567891), `gt(rate, 0.1234567891)`},
+		{"between", Between(testAge, 18, 30), `between(age, 18, 30)`},
+		{"has", Has(testAge), `has(age)`},
+		{"anyofterms", AnyOfTerms(testName, "a b"), `anyofterms(name, "a b")`},
+		{"regexp", Regexp(testName, "^a/b", "i"), `regexp(name, /^a\/b/i)`},
+		{"regexp escaped slash", Regexp(testName, `^a/b\/c`, ""), `regexp(name, /^a\/b\/c/)`},
+		{"regexp escaped backslash", Regexp(testName, `a\\/b`, ""), `regexp(name, /a\\\/b/)`},
+		{"uid", Uids("0x1", "v"), `uid(0x1, v)`},
+		{"uid_in", UidIn(testFri, "0x1"), `uid_in(friend, 0x1)`},
+		{"type", OfType("Person"), `type(Person)`},
+		{"lang", Eq(testName.WithLang("en:."), "x"), `eq(name@en, "x")`},
+		{"and", And(Eq(testAge, 1), Has(testName)), `eq(age, 1) AND has(name)`},
+		{"or", Or(Eq(testAge, 1), Eq(testAge, 2)), `eq(age, 1) OR eq(age, 2)`},
+		{"not", Not(Has(testName)), `NOT has(name)`},
+		{"nested", And(Has(testAge), Or(Eq(testAge, 1), Not(Has(testName)))), `has(age) AND (eq(age, 1) OR (NOT has(name)))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter.filter()
+			if err != nil {
+				t.Fatalf("filter: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"numeric on string", Gt(testName, 1), "gt: predicate name, cannot convert"},
+		{"string on int", Eq(testAge, "1"), "eq: predicate age, cannot convert"},
+		{"compare bool", Lt(testOn, true), "lt: predicate active of type bool is not supported"},
+		{"missing index", AnyOfText(testName, "a"), "anyoftext: predicate name requires @index(fulltext)"},
+		{"no value", Eq(testAge), "eq: predicate age, no value"},
+		{"nil value", Eq(testAge, (*int)(nil)), "eq: predicate age, nil value"},
+		{"bad regexp", Regexp(testName, "(", ""), "regexp: predicate name"},
+		{"bad flags", Regexp(testName, "a", "g"), "regexp: unsupported flags g"},
+		{"uid_in on value", UidIn(testAge, "0x1"), "uid_in: predicate age of type int is not supported"},
+		{"bad uid", Uids("x y"), "uid: invalid uid value x y"},
+		{"empty and", And(), "AND: no filter"},
+		{"error in and", And(Has(testAge), Gt(testName, 1)), "gt: predicate name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.filter.filter()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuild(t *testing.T) {
+	q, err := NewQuery(
+		NewVarBlock(Eq(testName, "a")).As("v"),
+		NewBlock("q", Uids("v")).
+			Filter(And(Ge(testAge, 18), Not(Has(testRate)))).
+			OrderAsc(testAge).First(10).Offset(5).
+			Uid().
+			Select(testName, testAge).
+			Edge(NewEdge(testFri).Filter(Eq(testOn, true)).Select(testName)),
+	).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+	v as var(func: eq(name, "a")) {
+	}
+	q(func: uid(v), orderasc: age, first: 10, offset: 5) @filter(ge(age, 18) AND (NOT has(rate))) {
+		uid
+		name
+		age
+		friend @filter(eq(active, true)) {
+			name
+		}
+	}
+}`
+	if q != want {
+		t.Errorf("got\n%s\nwant\n%s", q, want)
+	}
+}
+
+func TestQueryBuildErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Query
+		want  string
+	}{
+		{"empty", NewQuery(), "empty query"},
+		{"bad block name", NewQuery(NewBlock("a b", Has(testAge))), "invalid block name a b"},
+		{"bad root", NewQuery(NewBlock("q", Gt(testName, 1))), "gt: predicate name"},
+		{"bad filter", NewQuery(NewBlock("q", Has(testAge)).Filter(Lt(testOn, true))), "lt: predicate active"},
+		{"edge on value", NewQuery(NewBlock("q", Has(testAge)).Edge(NewEdge(testAge))), "edge: predicate age of type int is not uid"},
+		{"bad variable", NewQuery(NewBlock("q", Has(testAge)).UidAs("1v")), "invalid variable name 1v"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.query.Build()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
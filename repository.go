@@ -0,0 +1,278 @@
+package dgraph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"reflect"
+	"strings"
+)
+
+const (
+	blankNew   = "_:new"
+	queryBlock = "q"
+)
+
+var ErrNotFound = errors.New("node not found")
+
+// Repository 基于类型定义的增删改查
+type Repository[T any] struct {
+	client *Client
+	typ    Type[T]
+}
+
+// NewRepository 创建类型 T 的数据仓库
+func NewRepository[T any](client *Client, typ Type[T]) *Repository[T] {
+	return &Repository[T]{client: client, typ: typ}
+}
+
+// Type 返回仓库对应的类型定义
+func (r *Repository[T]) Type() Type[T] {
+	return r.typ
+}
+
+// Create 新增节点，并将生成的UID写回 data 的 Uid 字段
+// 嵌套的uid结构体没有UID时一并新增，提交后写回其 Uid 字段
+// 违反非空或唯一约束时返回 *ConstraintError
+func (r *Repository[T]) Create(ctx context.Context, data *T) error {
+	if err := r.typ.CheckNotNull(*data); err != nil {
+		return err
+	}
+	var blanks BlankNodes
+	nquads, err := r.typ.NquadBlank(blankNew, data, &blanks)
+	if err != nil {
+		return err
+	}
+	nquads = append(nquads, r.typ.NquadDType(blankNew))
+	req, checks, err := r.typ.upsertRequest(blankNew, *data, nquads, nil)
+	if err != nil {
+		return err
+	}
+	var uids map[string]string
+	err = r.client.RunInTxn(ctx, func(txn *Txn) error {
+		resp, err := txn.Do(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err = checkUnique(resp, checks); err != nil {
+			return err
+		}
+		if _, err = CheckResponse(resp); err != nil {
+			return err
+		}
+		uids = resp.Uids
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	setUid(data, uids[strings.TrimPrefix(blankNew, "_:")])
+	blanks.Assign(uids)
+	return nil
+}
+
+// Get 根据UID查询节点，节点不存在或类型不符时返回 ErrNotFound
+func (r *Repository[T]) Get(ctx context.Context, uid string) (*T, error) {
+	q := fmt.Sprintf("query q($uid: string) {\n%s(func: uid($uid)) @filter(type(%s)) {\n%s\n}\n}",
+		queryBlock, r.typ.Name, r.typ.Selection())
+	list, err := r.query(ctx, q, map[string]string{"$uid": uid})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return list[0], nil
+}
+
+// List 分页查询该类型的所有节点，first 和 offset 不大于0时不分页
+func (r *Repository[T]) List(ctx context.Context, first, offset int) ([]*T, error) {
+	var page string
+	if first > 0 {
+		page += fmt.Sprintf(", first: %d", first)
+	}
+	if offset > 0 {
+		page += fmt.Sprintf(", offset: %d", offset)
+	}
+	q := fmt.Sprintf("{\n%s(func: type(%s)%s) {\n%s\n}\n}",
+		queryBlock, r.typ.Name, page, r.typ.Selection())
+	return r.query(ctx, q, nil)
+}
+
+// Update 更新节点中的非零值字段，data 的 Uid 字段不能为空
+// 嵌套的uid结构体没有UID时作为新节点新增，提交后写回其 Uid 字段
+// 违反唯一约束时返回 *ConstraintError
+func (r *Repository[T]) Update(ctx context.Context, data *T) error {
+	uid := getUid(data)
+	if uid == "" {
+		return &ValidationError{Type: r.typ.Name, Field: Uid, Msg: "empty uid value"}
+	}
+	var blanks BlankNodes
+	nquads, err := r.typ.NquadBlank(uid, data, &blanks)
+	if err != nil {
+		return err
+	}
+	if len(nquads) == 0 {
+		return nil
+	}
+	req, checks, err := r.typ.upsertRequest(uid, *data, nquads, nil)
+	if err != nil {
+		return err
+	}
+	var uids map[string]string
+	err = r.client.RunInTxn(ctx, func(txn *Txn) error {
+		resp, err := txn.Do(ctx, req)
+		if err != nil {
+			return err
+		}
+		uids = resp.Uids
+		return checkUnique(resp, checks)
+	})
+	if err != nil {
+		return err
+	}
+	blanks.Assign(uids)
+	return nil
+}
+
+// UpdateFields 按字段掩码更新节点，规则见 Type.MaskNquads，data 的 Uid 字段不能为空
+// 嵌套的uid结构体没有UID时作为新节点新增，提交后写回其 Uid 字段
+// 违反非空或唯一约束时返回 *ConstraintError
+func (r *Repository[T]) UpdateFields(ctx context.Context, data *T, mask ...string) error {
+	uid := getUid(data)
+	if uid == "" {
+		return &ValidationError{Type: r.typ.Name, Field: Uid, Msg: "empty uid value"}
+	}
+	var blanks BlankNodes
+	set, del, err := r.typ.MaskNquads(uid, data, mask, &blanks)
+	if err != nil {
+		return err
+	}
+	if len(set) == 0 && len(del) == 0 {
+		return nil
+	}
+	only, err := r.typ.maskFields(mask)
+	if err != nil {
+		return err
+	}
+	req, checks, err := r.typ.upsertRequest(uid, *data, set, only)
+	if err != nil {
+		return err
+	}
+	var uids map[string]string
+	err = r.client.RunInTxn(ctx, func(txn *Txn) error {
+		// 删除和写入分两次执行，保证列表字段先清空再写入
+		if len(del) > 0 {
+			if _, err := txn.Mutate(ctx, &api.Mutation{Del: del}); err != nil {
+				return err
+			}
+		}
+		if len(set) == 0 {
+			return nil
+		}
+		resp, err := txn.Do(ctx, req)
+		if err != nil {
+			return err
+		}
+		uids = resp.Uids
+		return checkUnique(resp, checks)
+	})
+	if err != nil {
+		return err
+	}
+	blanks.Assign(uids)
+	return nil
+}
+
+// Delete 删除节点的所有谓词，并在同一事务中删除 cascade=delete 谓词指向的子节点及其级联的后代节点
+// 只删除这些节点自身的谓词，其他节点指向它们的边不会被删除，查询时这些边仍会返回只有UID的节点
+func (r *Repository[T]) Delete(ctx context.Context, uid string) error {
+	if uid == "" {
+		return &ValidationError{Type: r.typ.Name, Field: Uid, Msg: "empty uid value"}
+	}
+	edges := cascadeEdges(reflect.TypeOf(r.typ.DataModel), r.typ.Fields)
+	return r.client.RunInTxn(ctx, func(txn *Txn) error {
+		pending := []cascadeLevel{{uids: []string{uid}, edges: edges}}
+		children, err := cascadeNquads(ctx, txn, pending, map[string]bool{uid: true}, r.typ.nested)
+		if err != nil {
+			return err
+		}
+		_, err = txn.Mutate(ctx, &api.Mutation{Del: append(r.typ.NquadAll(uid), children...)})
+		return err
+	})
+}
+
+// DeleteFields 删除节点中 partial 的非零值字段，规则见 Type.DeleteNquads
+// 被删除的边属于 cascade=delete 谓词时，在同一事务中删除对应的子节点及其级联的后代节点
+// 与 Delete 相同，其他节点指向被删除子节点的边会保留
+func (r *Repository[T]) DeleteFields(ctx context.Context, uid string, partial *T) error {
+	nquads, children, all, err := r.typ.deleteNquads(uid, reflect.ValueOf(partial))
+	if err != nil {
+		return err
+	}
+	if len(nquads) == 0 {
+		return nil
+	}
+	return r.client.RunInTxn(ctx, func(txn *Txn) error {
+		var (
+			del     = append([]*api.NQuad(nil), nquads...)
+			seen    = map[string]bool{uid: true}
+			pending = []cascadeLevel{{uids: []string{uid}, edges: all}}
+		)
+		for _, child := range children {
+			if seen[child.uid] {
+				continue
+			}
+			seen[child.uid] = true
+			del = append(del, deleteNodeNquad(child.uid))
+			edges, err := nestedCascadeEdges(child.typ, r.typ.nested)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, cascadeLevel{uids: []string{child.uid}, edges: edges})
+		}
+		descendants, err := cascadeNquads(ctx, txn, pending, seen, r.typ.nested)
+		if err != nil {
+			return err
+		}
+		_, err = txn.Mutate(ctx, &api.Mutation{Del: append(del, descendants...)})
+		return err
+	})
+}
+
+func (r *Repository[T]) query(ctx context.Context, q string, vars map[string]string) ([]*T, error) {
+	txn := r.client.Txn(true)
+	resp, err := txn.QueryWithVars(ctx, q, vars)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := r.typ.Decode(resp.Json, queryBlock)
+	if err != nil {
+		return nil, err
+	}
+	var list = make([]*T, 0, len(nodes))
+	for i := range nodes {
+		list = append(list, &nodes[i])
+	}
+	return list, nil
+}
+
+func getUid(data any) string {
+	val := reflect.ValueOf(data)
+	if val.Kind() == reflect.Pointer {
+		val = val.Elem()
+	}
+	uidVal := val.FieldByName(Uid)
+	if !uidVal.IsValid() || uidVal.Kind() != reflect.String {
+		return ""
+	}
+	return uidVal.String()
+}
+
+func setUid(data any, uid string) {
+	uidVal := reflect.ValueOf(data).Elem().FieldByName(Uid)
+	if uidVal.IsValid() && uidVal.CanSet() && uidVal.Kind() == reflect.String {
+		uidVal.SetString(uid)
+	}
+}
@@ -0,0 +1,151 @@
+package dgraph_test
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-common/dgraph"
+	"reflect"
+	"testing"
+)
+
+type chapter struct {
+	Uid   string
+	Title string `db:"chapter.title"`
+}
+
+type book struct {
+	Uid      string
+	Title    string    `db:"book.title,index=exact"`
+	Chapters []chapter `db:"book.chapters,cascade=delete"`
+}
+
+type author struct {
+	Uid   string
+	Name  string            `db:"author.name,index=exact,unique"`
+	Email string            `db:"author.email,notnull"`
+	Age   int               `db:"author.age"`
+	Tags  []string          `db:"author.tags"`
+	Bio   map[string]string `db:"author.bio"`
+	Books []book            `db:"author.books,cascade=delete"`
+}
+
+func mustType[T any](t *testing.T, opts ...dgraph.TypeOption) dgraph.Type[T] {
+	t.Helper()
+	typ, err := dgraph.TypeOf[T](opts...)
+	if err != nil {
+		t.Fatalf("TypeOf: %v", err)
+	}
+	return typ
+}
+
+// newLibrary 创建 Author、Book、Chapter 三个类型的数据仓库并提交schema
+func newLibrary(t *testing.T) (*dgraph.Client, *dgraph.Repository[author], *dgraph.Repository[book]) {
+	t.Helper()
+	client := newTestClient(t)
+	chapterType := mustType[chapter](t, dgraph.WithTypeName("Chapter"))
+	bookType := mustType[book](t, dgraph.WithTypeName("Book"), dgraph.WithNestedType(chapterType))
+	authorType := mustType[author](t, dgraph.WithTypeName("Author"), dgraph.WithNestedType(bookType))
+	applyTypes(t, client, authorType, bookType, chapterType)
+	return client, dgraph.NewRepository(client, authorType), dgraph.NewRepository(client, bookType)
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	_, authors, _ := newLibrary(t)
+	ctx := context.Background()
+	alice := &author{Name: "Alice", Email: "alice@example.com", Age: 30, Tags: []string{"poet"}}
+	if err := authors.Create(ctx, alice); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if alice.Uid == "" {
+		t.Fatal("Create should write back the uid")
+	}
+	got, err := authors.Get(ctx, alice.Uid)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !reflect.DeepEqual(got, alice) {
+		t.Errorf("Get: got %+v, want %+v", got, alice)
+	}
+	for _, name := range []string{"Bob", "Carol"} {
+		if err = authors.Create(ctx, &author{Name: name, Email: name + "@example.com"}); err != nil {
+			t.Fatalf("Create %s: %v", name, err)
+		}
+	}
+	list, err := authors.List(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 3 {
+		t.Errorf("List: got %d authors, want 3", len(list))
+	}
+	page, err := authors.List(ctx, 2, 2)
+	if err != nil {
+		t.Fatalf("List page: %v", err)
+	}
+	if len(page) != 1 || page[0].Name != list[2].Name {
+		t.Errorf("List(2, 2): got %+v, want [%s]", page, list[2].Name)
+	}
+
+	// Update 只写入非零值字段
+	if err = authors.Update(ctx, &author{Uid: alice.Uid, Age: 31}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, err = authors.Get(ctx, alice.Uid); err != nil {
+		t.Fatalf("Get after update: %v", err)
+	}
+	if got.Age != 31 || got.Name != "Alice" || got.Email != alice.Email {
+		t.Errorf("Update: got %+v", got)
+	}
+
+	if err = authors.Delete(ctx, alice.Uid); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err = authors.Get(ctx, alice.Uid); !errors.Is(err, dgraph.ErrNotFound) {
+		t.Errorf("Get after delete: got %v, want %v", err, dgraph.ErrNotFound)
+	}
+	if err = authors.Update(ctx, &author{Age: 1}); err == nil {
+		t.Error("Update without uid should fail")
+	}
+}
+
+func TestRepositoryConstraints(t *testing.T) {
+	_, authors, _ := newLibrary(t)
+	ctx := context.Background()
+	alice := &author{Name: "Alice", Email: "alice@example.com"}
+	if err := authors.Create(ctx, alice); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var cerr *dgraph.ConstraintError
+	err := authors.Create(ctx, &author{Name: "Alice", Email: "other@example.com"})
+	if !errors.As(err, &cerr) {
+		t.Fatalf("duplicate Create: got %v, want *ConstraintError", err)
+	}
+	want := dgraph.ConstraintError{Pred: "author.name", Constraint: dgraph.ConstraintUnique, Uid: alice.Uid}
+	if *cerr != want {
+		t.Errorf("duplicate Create: got %+v, want %+v", *cerr, want)
+	}
+	list, err := authors.List(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Errorf("rejected Create should not write, got %d authors", len(list))
+	}
+
+	bob := &author{Name: "Bob", Email: "bob@example.com"}
+	if err = authors.Create(ctx, bob); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err = authors.Update(ctx, &author{Uid: bob.Uid, Name: "Alice"}); !errors.As(err, &cerr) || cerr.Uid != alice.Uid {
+		t.Errorf("duplicate Update: got %v, want unique conflict with %s", err, alice.Uid)
+	}
+	// 节点自身的值不算冲突
+	if err = authors.Update(ctx, &author{Uid: alice.Uid, Name: "Alice", Age: 30}); err != nil {
+		t.Errorf("Update with own value: %v", err)
+	}
+
+	err = authors.Create(ctx, &author{Name: "Carol"})
+	if !errors.As(err, &cerr) || cerr.Pred != "author.email" || cerr.Constraint != dgraph.ConstraintNotNull {
+		t.Errorf("empty email: got %v, want not null violation", err)
+	}
+}
@@ -0,0 +1,97 @@
+package dgraph
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 事务冲突重试策略
+// MaxAttempts - 最大尝试次数(含首次)，小于1时按1处理
+// BaseDelay - 首次重试前的等待时间，之后按指数增长
+// MaxDelay - 单次等待时间上限
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy 默认重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   20 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// backoff 返回第 attempt 次失败后的等待时间，采用指数退避并在后半区间随机抖动
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	if r.BaseDelay <= 0 {
+		return 0
+	}
+	delay := r.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if r.MaxDelay > 0 && delay >= r.MaxDelay {
+			delay = r.MaxDelay
+			break
+		}
+	}
+	if r.MaxDelay > 0 && delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// TxnOption RunInTxn 的可选参数
+type TxnOption func(policy *RetryPolicy)
+
+// WithMaxAttempts 设置最大尝试次数
+func WithMaxAttempts(n int) TxnOption {
+	return func(policy *RetryPolicy) {
+		policy.MaxAttempts = n
+	}
+}
+
+// WithBackoff 设置指数退避的初始等待时间和等待时间上限
+func WithBackoff(base, max time.Duration) TxnOption {
+	return func(policy *RetryPolicy) {
+		policy.BaseDelay = base
+		policy.MaxDelay = max
+	}
+}
+
+// RunInTxn 在读写事务中执行 fn 并提交，事务因冲突被中止时按重试策略重新执行
+// fn 内不应自行提交或丢弃事务，每次重试都会传入新的事务
+func (d *Client) RunInTxn(ctx context.Context, fn func(txn *Txn) error, opts ...TxnOption) error {
+	var policy = d.retry
+	for _, opt := range opts {
+		opt(&policy)
+	}
+	for attempt := 1; ; attempt++ {
+		err := d.runOnce(ctx, fn)
+		if err == nil {
+			return nil
+		}
+		if !IsAborted(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// runOnce 执行一次事务，无论成功与否都会丢弃事务(提交后丢弃为空操作)
+func (d *Client) runOnce(ctx context.Context, fn func(txn *Txn) error) error {
+	txn := d.Txn(false)
+	defer txn.Discard(ctx)
+	if err := fn(txn); err != nil {
+		return err
+	}
+	return txn.Commit(ctx)
+}
@@ -0,0 +1,66 @@
+package dgraph_test
+
+import (
+	"context"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"testing"
+	"time"
+)
+
+func TestRunInTxnRetry(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	resp, err := client.Txn(false).Mutate(ctx, &api.Mutation{SetNquads: []byte(`_:a <n> "0" .`), CommitNow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := func(val string) *api.Mutation {
+		return &api.Mutation{SetNquads: []byte("<" + resp.Uids["a"] + "> <n> \"" + val + "\" .")}
+	}
+	// conflict 在事务提交前由另一个事务写入同一谓词，使本次提交被中止
+	conflict := func(txn *dgraph.Txn) error {
+		if _, err := txn.Mutate(ctx, set("1")); err != nil {
+			return err
+		}
+		other := set("2")
+		other.CommitNow = true
+		_, err := client.Txn(false).Mutate(ctx, other)
+		return err
+	}
+
+	var attempts int
+	err = client.RunInTxn(ctx, func(txn *dgraph.Txn) error {
+		attempts++
+		if attempts == 1 {
+			return conflict(txn)
+		}
+		_, err := txn.Mutate(ctx, set("3"))
+		return err
+	}, dgraph.WithBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatalf("RunInTxn: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want 2", attempts)
+	}
+	r, err := client.Txn(true).Query(ctx, "{ q(func: uid("+resp.Uids["a"]+")) { n } }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(r.Json); got != `{"q":[{"n":"3"}]}` {
+		t.Errorf("got %s, want the retried write", got)
+	}
+
+	attempts = 0
+	err = client.RunInTxn(ctx, func(txn *dgraph.Txn) error {
+		attempts++
+		return conflict(txn)
+	}, dgraph.WithMaxAttempts(3), dgraph.WithBackoff(time.Millisecond, time.Millisecond))
+	if !dgraph.IsAborted(err) {
+		t.Errorf("got %v, want an aborted error", err)
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3", attempts)
+	}
+}
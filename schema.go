@@ -19,7 +19,19 @@ type Schema struct {
 	Types []SchemaType `json:"types" schema:"types"`
 }
 
-// SkipSysSchema 忽略dgraph系统自身schema
+// Rdf 将所有谓词和类型转换为一份schema文档
+func (s Schema) Rdf() string {
+	var lines []string
+	for _, p := range s.Preds {
+		lines = append(lines, p.Rdf())
+	}
+	for _, t := range s.Types {
+		lines = append(lines, t.Rdf())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SkipSysSchema 忽略dgraph系统自身schema以及迁移记录使用的schema
 func (s Schema) SkipSysSchema() Schema {
 	var (
 		r     Schema
@@ -27,13 +39,13 @@ func (s Schema) SkipSysSchema() Schema {
 		types []SchemaType
 	)
 	for _, p := range s.Preds {
-		if strings.HasPrefix(p.Name, "dgraph.") {
+		if strings.HasPrefix(p.Name, "dgraph.") || strings.HasPrefix(p.Name, MigrationPrefix) {
 			continue
 		}
 		preds = append(preds, p)
 	}
 	for _, v := range s.Types {
-		if strings.HasPrefix(v.Name, "dgraph.") {
+		if strings.HasPrefix(v.Name, "dgraph.") || v.Name == MigrationType || v.Name == MigrationLockType {
 			continue
 		}
 		types = append(types, v)
@@ -123,6 +135,7 @@ Loop:
 }
 
 // compareTwoType 比较两个类型是否一致
+// 只检查新类型的字段是否都在旧类型中，旧类型多出的字段不视为不一致；完整的字段差异见 Schema.Diff
 func (s Schema) compareTwoType(new, old SchemaType) bool {
 Loop:
 	for _, newfield := range new.Fields {
@@ -138,15 +151,17 @@ Loop:
 
 // SchemaPred 谓词数据结构
 type SchemaPred struct {
-	Name    string   `json:"predicate" schema:"predicate"`
-	Type    PredType `json:"type" schema:"type"`
-	Index   bool     `json:"index" schema:"index"`
-	Tokens  []string `json:"tokenizer" schema:"tokenizer"`
-	Reverse bool     `json:"reverse" schema:"reverse"`
-	Count   bool     `json:"count" schema:"count"`
-	List    bool     `json:"list" schema:"list"`
-	Upsert  bool     `json:"upsert" schema:"upsert"`
-	Lang    bool     `json:"lang" schema:"lang"`
+	Name        string   `json:"predicate" schema:"predicate"`
+	Type        PredType `json:"type" schema:"type"`
+	Index       bool     `json:"index" schema:"index"`
+	Tokens      []string `json:"tokenizer" schema:"tokenizer"`
+	Reverse     bool     `json:"reverse" schema:"reverse"`
+	Count       bool     `json:"count" schema:"count"`
+	List        bool     `json:"list" schema:"list"`
+	Upsert      bool     `json:"upsert" schema:"upsert"`
+	Lang        bool     `json:"lang" schema:"lang"`
+	NoConflict  bool     `json:"no_conflict" schema:"no_conflict"`
+	UniqueIndex bool     `json:"unique" schema:"unique"` // @unique 指令，Pred.Unique 为应用层的唯一约束
 }
 
 func (s SchemaPred) Rdf() string {
@@ -173,6 +188,12 @@ func (s SchemaPred) Rdf() string {
 	if s.Lang {
 		indices = append(indices, "@lang")
 	}
+	if s.NoConflict {
+		indices = append(indices, "@noconflict")
+	}
+	if s.UniqueIndex {
+		indices = append(indices, "@unique")
+	}
 
 	replacer := strings.NewReplacer(
 		"$name", s.Name,
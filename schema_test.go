@@ -0,0 +1,44 @@
+package dgraph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUniqueIndexTagRoundTrip(t *testing.T) {
+	type account struct {
+		Uid   string
+		Email string `db:"account.email,index=exact,unique,unique_index"`
+		Name  string `db:"account.name,unique"`
+	}
+	typ, err := TypeOf[account]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := typ.Fields["Email"]
+	if !email.Unique || !email.UniqueIndex {
+		t.Fatalf("unique and unique_index should set the constraint and the directive: %+v", email)
+	}
+	var lines []string
+	for _, name := range []string{"Email", "Name"} {
+		lines = append(lines, typ.Fields[name].Schema().Rdf())
+	}
+	rdf := strings.Join(lines, "\n")
+	if !strings.Contains(lines[0], "@unique") {
+		t.Fatalf("Rdf() missing @unique: %s", lines[0])
+	}
+	s, err := ParseSchema(rdf)
+	if err != nil {
+		t.Fatalf("ParseSchema(%q): %v", rdf, err)
+	}
+	preds := make(map[string]SchemaPred)
+	for _, p := range s.Preds {
+		preds[p.Name] = p
+	}
+	if !preds["account.email"].UniqueIndex {
+		t.Errorf("account.email lost @unique: %+v", preds["account.email"])
+	}
+	if preds["account.name"].UniqueIndex {
+		t.Errorf("unique alone should not emit @unique: %+v", preds["account.name"])
+	}
+}
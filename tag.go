@@ -0,0 +1,290 @@
+package dgraph
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// dbTag 返回字段 db 标签中的谓词名称(第一个逗号之前的部分)
+func dbTag(field reflect.StructField) string {
+	tag := field.Tag.Get(Db)
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		tag = tag[:i]
+	}
+	return strings.TrimSpace(tag)
+}
+
+// parseTag 解析扩展的 db 标签，如 `db:"user.email,index=hash+trigram,upsert,unique"`
+// 支持的选项:
+// index=tok1+tok2 - 索引及分词器
+// type=xxx - 显式指定谓词类型，如 password、default
+// reverse、count、upsert - 对应schema指令
+// lang 或 lang=en - 开启 @lang，并可指定读写使用的语言，如 lang=zh:en:. 按顺序回退，写入时使用第一个语言
+// unique、notnull、pri - 唯一、非空和主键约束，由upsert块在写入时检查
+// unique_index - 生成 @unique 指令，由服务端保证唯一，需要dgraph v24及以上版本
+// cascade=delete - uid谓词的级联删除，删除节点时一并删除其指向的子节点
+func parseTag(pred *Pred, tag string) error {
+	parts := strings.Split(tag, ",")
+	pred.Name = strings.TrimSpace(parts[0])
+	for _, opt := range parts[1:] {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		key, val, hasVal := strings.Cut(opt, "=")
+		switch key {
+		case "index":
+			if !hasVal || val == "" {
+				return fmt.Errorf("predicate %s, index option requires tokenizers", pred.Name)
+			}
+			pred.Index = true
+			pred.Tokens = strings.Split(val, "+")
+		case "type":
+			if !hasVal || val == "" {
+				return fmt.Errorf("predicate %s, type option requires a value", pred.Name)
+			}
+			pred.Type = PredType(val)
+		case "lang":
+			pred.Lang = true
+			pred.LangType = val
+		case "cascade":
+			if val != CascadeDelete {
+				return fmt.Errorf("predicate %s, unknown cascade policy %s", pred.Name, val)
+			}
+			pred.Cascade = val
+		case "reverse", "count", "upsert", "unique", "unique_index", "notnull", "pri":
+			if hasVal {
+				return fmt.Errorf("predicate %s, option %s takes no value", pred.Name, key)
+			}
+			switch key {
+			case "reverse":
+				pred.Reverse = true
+			case "count":
+				pred.Count = true
+			case "upsert":
+				pred.Upsert = true
+			case "unique":
+				pred.Unique = true
+			case "unique_index":
+				pred.UniqueIndex = true
+			case "notnull":
+				pred.NotNull = true
+			case "pri":
+				pred.Pri = true
+			}
+		default:
+			return fmt.Errorf("predicate %s, unknown tag option %s", pred.Name, key)
+		}
+	}
+	return nil
+}
+
+// inferPredType 根据Go类型推断谓词类型，返回是否为列表以及类型是否可推断
+func inferPredType(typ reflect.Type) (PredType, bool, bool) {
+	var list bool
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 {
+		typ = typ.Elem()
+		list = true
+	}
+	if typ.Implements(geomType) {
+		return TypeGeo, list, true
+	}
+	// map[string]string 为同一谓词不同语言的值
+	if !list && isLangMap(typ) {
+		return TypeString, list, true
+	}
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == timeType {
+		return TypeDatetime, list, true
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return TypeString, list, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return TypeInt, list, true
+	case reflect.Float32, reflect.Float64:
+		return TypeFloat, list, true
+	case reflect.Bool:
+		return TypeBool, list, true
+	case reflect.Struct:
+		return TypeUid, list, true
+	}
+	return "", list, false
+}
+
+// compatible 判断谓词类型 p 能否存储推断出的类型 inferred
+func (p PredType) compatible(inferred PredType) bool {
+	if p == inferred {
+		return true
+	}
+	return inferred == TypeString && (p == TypePassword || p == TypeDefault)
+}
+
+// TypeOption TypeOf 的可选参数
+type TypeOption func(t *typeOptions)
+
+type typeOptions struct {
+	name   string
+	nested typeDefs
+}
+
+// WithTypeName 指定类型名称，默认使用结构体名称
+func WithTypeName(name string) TypeOption {
+	return func(t *typeOptions) {
+		t.name = name
+	}
+}
+
+// WithNestedType 指定嵌套结构体 N 作为新节点写入或级联删除时使用的类型定义，如 WithTypeName 指定的类型名称
+// 未指定的嵌套结构体使用结构体名称作为类型名称，并跳过没有 db 标签的字段
+// nested 自身通过 WithNestedType 指定的类型定义一并生效
+func WithNestedType[N any](nested Type[N]) TypeOption {
+	return func(t *typeOptions) {
+		typ := reflect.TypeOf(nested.DataModel)
+		if typ == nil {
+			return
+		}
+		if t.nested == nil {
+			t.nested = make(typeDefs)
+		}
+		t.nested[typ] = nodeTypeDef{name: nested.Name, fields: nested.Fields}
+		for typ, def := range nested.nested {
+			if _, ok := t.nested[typ]; !ok {
+				t.nested[typ] = def
+			}
+		}
+	}
+}
+
+// TypeOf 通过反射 T 的 db 标签生成类型定义
+// 谓词类型由字段的Go类型推断，uid谓词的边属性由子结构体中 pred|facet 标签的字段推断
+// uid谓词可以使用 cascade=delete 选项，删除节点时一并删除其指向的子节点
+// 字段没有 db 标签、类型无法推断、与显式指定的类型不符或谓词重复时返回错误
+func TypeOf[T any](opts ...TypeOption) (Type[T], error) {
+	var (
+		model T
+		typ   = reflect.TypeOf(model)
+		o     typeOptions
+	)
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return Type[T]{}, &ValidationError{Type: fmt.Sprintf("%T", model), Msg: "not a struct"}
+	}
+	o.name = typ.Name()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.name == "" {
+		return Type[T]{}, &ValidationError{Type: fmt.Sprintf("%T", model), Msg: "type has no name"}
+	}
+	t := Type[T]{Name: o.name, DataModel: model, Fields: make(map[string]Pred), nested: o.nested}
+	if err := t.collect(typ, make(map[string]string), true); err != nil {
+		return Type[T]{}, err
+	}
+	return t, nil
+}
+
+// collect 收集结构体字段对应的谓词，匿名结构体字段展开到同一类型
+// names 记录谓词名称到字段名的映射，用于检查重复谓词
+// strict 为 false 时跳过没有 db 标签或无法转换为谓词的字段，用于推断嵌套结构体的类型
+func (t *Type[T]) collect(typ reflect.Type, names map[string]string, strict bool) error {
+	for i := 0; i < typ.NumField(); i++ {
+		if err := t.collectField(typ.Field(i), names, strict); err != nil && strict {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectField 收集单个字段对应的谓词
+func (t *Type[T]) collectField(field reflect.StructField, names map[string]string, strict bool) error {
+	if field.Name == Uid || !field.IsExported() {
+		return nil
+	}
+	tag := field.Tag.Get(Db)
+	ftyp := nodeType(field.Type)
+	if field.Anonymous && tag == "" && ftyp.Kind() == reflect.Struct {
+		return t.collect(ftyp, names, strict)
+	}
+	if tag == "-" {
+		return nil
+	}
+	if tag == "" {
+		return &ValidationError{Type: t.Name, Field: field.Name, Msg: "no db tag"}
+	}
+	var pred Pred
+	if err := parseTag(&pred, tag); err != nil {
+		return &ValidationError{Type: t.Name, Field: field.Name, Err: err}
+	}
+	// 边属性由所在的uid谓词收集
+	if strings.Contains(pred.Name, "|") {
+		return nil
+	}
+	inferred, list, ok := inferPredType(field.Type)
+	if !ok {
+		return &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Msg: fmt.Sprintf("cannot infer predicate type from %s", field.Type)}
+	}
+	if strings.HasPrefix(pred.Name, "~") {
+		if inferred != TypeUid {
+			return &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Msg: "reverse field must be a struct"}
+		}
+		if pred.Cascade != "" {
+			return &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Msg: "reverse field cannot cascade"}
+		}
+		t.RevPreds = append(t.RevPreds, SchemaPred{
+			Name: strings.TrimPrefix(pred.Name, "~"), Type: TypeUid, Reverse: true,
+		})
+		return nil
+	}
+	if pred.Type == "" {
+		pred.Type = inferred
+	} else if !pred.Type.compatible(inferred) {
+		return &SchemaMismatchError{Type: t.Name, Field: field.Name, Pred: pred.Name,
+			Expected: "type " + string(pred.Type), Actual: "go type " + field.Type.String()}
+	}
+	pred.List = list
+	if err := checkLang(&pred, field.Type); err != nil {
+		return &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Err: err}
+	}
+	if pred.Cascade != "" && pred.Type != TypeUid {
+		return &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Msg: "cascade requires a uid predicate"}
+	}
+	if pred.Type == TypeUid {
+		facets, err := facetsOf(ftyp, pred.Name)
+		if err != nil {
+			return &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Err: err}
+		}
+		pred.Facets = facets
+	}
+	if exist, ok := names[pred.Name]; ok {
+		return &ValidationError{Type: t.Name, Field: field.Name, Pred: pred.Name, Msg: "predicate is also used by field " + exist}
+	}
+	names[pred.Name] = field.Name
+	t.Fields[field.Name] = pred
+	return nil
+}
+
+// facetsOf 从子结构体中 db 标签为 pred|facet 的字段推断边属性，key 为字段名
+func facetsOf(typ reflect.Type, pred string) (map[string]Facet, error) {
+	var r map[string]Facet
+	prefix := pred + "|"
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := dbTag(field)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		inferred, list, ok := inferPredType(field.Type)
+		if !ok || list || inferred == TypeUid || inferred == TypeGeo {
+			return nil, fmt.Errorf("unsupported facet type %s of field %s", field.Type, field.Name)
+		}
+		if r == nil {
+			r = make(map[string]Facet)
+		}
+		r[field.Name] = Facet{Name: strings.TrimPrefix(name, prefix), Type: inferred.String()}
+	}
+	return r, nil
+}
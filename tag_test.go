@@ -0,0 +1,111 @@
+package dgraph_test
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-common/dgraph"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTypeOf(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	typ := mustType[author](t, dgraph.WithTypeName("Author"))
+	want := map[string]dgraph.SchemaPred{
+		"Name":  {Name: "author.name", Type: dgraph.TypeString, Index: true, Tokens: []string{"exact"}},
+		"Email": {Name: "author.email", Type: dgraph.TypeString},
+		"Age":   {Name: "author.age", Type: dgraph.TypeInt},
+		"Tags":  {Name: "author.tags", Type: dgraph.TypeString, List: true},
+		"Bio":   {Name: "author.bio", Type: dgraph.TypeString, Lang: true},
+		"Books": {Name: "author.books", Type: dgraph.TypeUid, List: true},
+	}
+	if len(typ.Fields) != len(want) {
+		t.Errorf("got %d fields, want %d", len(typ.Fields), len(want))
+	}
+	for field, w := range want {
+		got := typ.Fields[field].Schema()
+		if got.Rdf() != w.Rdf() {
+			t.Errorf("%s: got %s, want %s", field, got.Rdf(), w.Rdf())
+		}
+	}
+	if name := typ.Fields["Name"]; !name.Unique {
+		t.Errorf("Name should be unique: %+v", name)
+	}
+	if books := typ.Fields["Books"]; books.Cascade != dgraph.CascadeDelete {
+		t.Errorf("Books should cascade: %+v", books)
+	}
+
+	// 类型定义提交后与服务端的schema一致
+	applyTypes(t, client, typ)
+	live, err := client.Txn(true).SchemaType(ctx, "Author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for _, f := range live.Fields {
+		fields = append(fields, f.Name)
+	}
+	sort.Strings(fields)
+	if got := strings.Join(fields, " "); got != "author.age author.bio author.books author.email author.name author.tags" {
+		t.Errorf("type Author: got fields %s", got)
+	}
+	for _, w := range want {
+		got, err := client.Txn(true).SchemaPred(ctx, w.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Rdf() != w.Rdf() {
+			t.Errorf("%s: got %s, want %s", w.Name, got.Rdf(), w.Rdf())
+		}
+	}
+}
+
+func TestTypeOfErrors(t *testing.T) {
+	type noTag struct {
+		Name string
+	}
+	type duplicate struct {
+		Name  string `db:"name"`
+		Alias string `db:"name"`
+	}
+	type valueCascade struct {
+		Name string `db:"name,cascade=delete"`
+	}
+	type intLang struct {
+		Age int `db:"age,lang=en"`
+	}
+	type mapLang struct {
+		Name map[string]string `db:"name,lang=en"`
+	}
+	type mismatch struct {
+		Age string `db:"age,type=int"`
+	}
+	tests := []struct {
+		name string
+		fn   func() error
+		want string
+	}{
+		{"no tag", func() error { _, err := dgraph.TypeOf[noTag](); return err }, "no db tag"},
+		{"duplicate", func() error { _, err := dgraph.TypeOf[duplicate](); return err }, "also used by field Name"},
+		{"value cascade", func() error { _, err := dgraph.TypeOf[valueCascade](); return err }, "cascade requires a uid predicate"},
+		{"int lang", func() error { _, err := dgraph.TypeOf[intLang](); return err }, "language requires a string predicate"},
+		{"map lang", func() error { _, err := dgraph.TypeOf[mapLang](); return err }, "map field cannot specify language en"},
+		{"not struct", func() error { _, err := dgraph.TypeOf[string](); return err }, "not a struct"},
+		{"mismatch", func() error { _, err := dgraph.TypeOf[mismatch](); return err }, "age"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+	_, err := dgraph.TypeOf[mismatch]()
+	var mismatchErr *dgraph.SchemaMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Errorf("mismatch: got %T, want *SchemaMismatchError", err)
+	}
+}
@@ -0,0 +1,177 @@
+package dgraph
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/credentials"
+	"os"
+	"sync"
+	"time"
+)
+
+// tlsOptions TLS相关的选项，文件形式的证书在修改后自动重新加载
+type tlsOptions struct {
+	caFile, servname  string
+	certFile, keyFile string
+	caPEM             []byte
+	certPEM, keyPEM   []byte
+	config            *tls.Config
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.caFile != "" || o.servname != "" || o.certFile != "" || o.keyFile != "" ||
+		len(o.caPEM) > 0 || len(o.certPEM) > 0 || len(o.keyPEM) > 0 || o.config != nil
+}
+
+// credentials 生成gRPC传输凭证，未配置TLS时返回 nil
+func (o tlsOptions) credentials() (credentials.TransportCredentials, error) {
+	if !o.enabled() {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.config != nil {
+		cfg = o.config.Clone()
+	}
+	if o.servname != "" {
+		cfg.ServerName = o.servname
+	}
+	switch {
+	case o.caFile != "" && len(o.caPEM) > 0:
+		return nil, errors.New("tls: ca file and ca pem are mutually exclusive")
+	case len(o.caPEM) > 0:
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(o.caPEM) {
+			return nil, errors.New("tls: no certificates found in ca pem")
+		}
+		cfg.RootCAs = pool
+	case o.caFile != "":
+		ca := &caReloader{file: o.caFile}
+		if _, err := ca.get(); err != nil {
+			return nil, err
+		}
+		// 跳过默认校验，改为使用最新加载的CA校验服务端证书
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = ca.verify
+	}
+	switch {
+	case (o.certFile != "" || o.keyFile != "") && (len(o.certPEM) > 0 || len(o.keyPEM) > 0):
+		return nil, errors.New("tls: client cert file and client cert pem are mutually exclusive")
+	case len(o.certPEM) > 0 || len(o.keyPEM) > 0:
+		pair, err := tls.X509KeyPair(o.certPEM, o.keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	case o.certFile != "" || o.keyFile != "":
+		if o.certFile == "" || o.keyFile == "" {
+			return nil, errors.New("tls: client cert requires both cert file and key file")
+		}
+		cert := &certReloader{certFile: o.certFile, keyFile: o.keyFile}
+		if _, err := cert.get(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.get()
+		}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// latestModTime 返回多个文件中最新的修改时间
+func latestModTime(files ...string) (time.Time, error) {
+	var r time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(r) {
+			r = info.ModTime()
+		}
+	}
+	return r, nil
+}
+
+// certReloader 客户端证书，文件修改后在下次握手时重新加载
+// 重新加载失败(如证书轮换过程中只写入了一个文件)时继续使用旧证书
+type certReloader struct {
+	mu                sync.Mutex
+	certFile, keyFile string
+	modTime           time.Time
+	cert              *tls.Certificate
+}
+
+func (r *certReloader) get() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mod, err := latestModTime(r.certFile, r.keyFile)
+	if err == nil && r.cert != nil && !mod.After(r.modTime) {
+		return r.cert, nil
+	}
+	if err == nil {
+		var pair tls.Certificate
+		if pair, err = tls.LoadX509KeyPair(r.certFile, r.keyFile); err == nil {
+			r.cert, r.modTime = &pair, mod
+			return r.cert, nil
+		}
+	}
+	if r.cert != nil {
+		return r.cert, nil
+	}
+	return nil, fmt.Errorf("tls: load client cert: %w", err)
+}
+
+// caReloader CA证书，文件修改后在下次握手时重新加载
+type caReloader struct {
+	mu      sync.Mutex
+	file    string
+	modTime time.Time
+	pool    *x509.CertPool
+}
+
+func (r *caReloader) get() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mod, err := latestModTime(r.file)
+	if err == nil && r.pool != nil && !mod.After(r.modTime) {
+		return r.pool, nil
+	}
+	if err == nil {
+		var b []byte
+		if b, err = os.ReadFile(r.file); err == nil {
+			pool := x509.NewCertPool()
+			if pool.AppendCertsFromPEM(b) {
+				r.pool, r.modTime = pool, mod
+				return r.pool, nil
+			}
+			err = fmt.Errorf("no certificates found in %s", r.file)
+		}
+	}
+	if r.pool != nil {
+		return r.pool, nil
+	}
+	return nil, fmt.Errorf("tls: load ca: %w", err)
+}
+
+// verify 使用当前CA校验服务端证书链和主机名
+func (r *caReloader) verify(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server did not present a certificate")
+	}
+	pool, err := r.get()
+	if err != nil {
+		return err
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
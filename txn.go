@@ -12,8 +12,8 @@ type Txn struct {
 }
 
 // Schema 获取dgraph所有谓词和类型
-func (d *Txn) Schema() (Schema, error) {
-	resp, err := d.Txn.Query(context.Background(), `schema{}`)
+func (d *Txn) Schema(ctx context.Context) (Schema, error) {
+	resp, err := d.Txn.Query(ctx, `schema{}`)
 	if err != nil {
 		return Schema{}, err
 	}
@@ -27,10 +27,10 @@ func (d *Txn) Schema() (Schema, error) {
 }
 
 // SchemaPred 查找特定谓词结构,如果不存在则报错
-func (d *Txn) SchemaPred(name string) (SchemaPred, error) {
+func (d *Txn) SchemaPred(ctx context.Context, name string) (SchemaPred, error) {
 	var res Schema
 	q := fmt.Sprintf(`schema(pred: %s){}`, name)
-	resp, err := d.Txn.Query(context.Background(), q)
+	resp, err := d.Txn.Query(ctx, q)
 	if err != nil {
 		return SchemaPred{}, err
 	}
@@ -46,9 +46,9 @@ func (d *Txn) SchemaPred(name string) (SchemaPred, error) {
 }
 
 // SchemaType 查找特定类型,如果不存在则报错
-func (d *Txn) SchemaType(name string) (SchemaType, error) {
+func (d *Txn) SchemaType(ctx context.Context, name string) (SchemaType, error) {
 	var res Schema
-	resp, err := d.Txn.Query(context.Background(), fmt.Sprintf(`schema(type: %s){}`, name))
+	resp, err := d.Txn.Query(ctx, fmt.Sprintf(`schema(type: %s){}`, name))
 	if err != nil {
 		return SchemaType{}, err
 	}
@@ -1,10 +1,10 @@
 package dgraph
 
 import (
-	"errors"
 	"fmt"
 	"github.com/dgraph-io/dgo/v210/protos/api"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -25,6 +25,7 @@ type Type[T any] struct {
 	DataModel T               `json:"dataModel,omitempty"`
 	Fields    map[string]Pred `json:"fields,omitempty"`
 	RevPreds  []SchemaPred    `json:"revPreds,omitempty"`
+	nested    typeDefs        // 嵌套结构体的类型定义，见 WithNestedType
 }
 
 func (t Type[T]) GetName() string {
@@ -51,32 +52,61 @@ func (t Type[T]) Schema() SchemaType {
 }
 
 func (t Type[T]) NquadDType(uid string) *api.NQuad {
+	return dtypeNquad(uid, t.Name)
+}
+
+// dtypeNquad 生成节点 uid 的 dgraph.type
+func dtypeNquad(uid, name string) *api.NQuad {
 	return &api.NQuad{
 		Subject:     uid,
 		Predicate:   "dgraph.type",
-		ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: t.Name}},
+		ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: name}},
 	}
 }
 
+// Nquad 将结构体转换为N-Quad，data 为结构体或结构体指针
+// 嵌套的uid结构体没有UID时作为新节点递归转换，见 NquadBlank
 func (t Type[T]) Nquad(uid string, data any) ([]*api.NQuad, error) {
+	return t.NquadBlank(uid, data, &BlankNodes{})
+}
+
+// NquadBlank 同 Nquad，嵌套的新节点由 blanks 分配空白节点并添加 dgraph.type
+// data 为指针时，提交后可以用 blanks.Assign 将新节点的UID写回嵌套结构体
+func (t Type[T]) NquadBlank(uid string, data any, blanks *BlankNodes) ([]*api.NQuad, error) {
+	if uid == "" {
+		return nil, &ValidationError{Type: t.Name, Field: Uid, Msg: "empty uid value"}
+	}
+	val := reflect.ValueOf(data)
+	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil, nil
+		}
+		val = val.Elem()
+	}
+	blanks.useTypes(t.nested)
+	return nodeNquad(t.Name, t.Fields, uid, val, blanks)
+}
+
+func (t Type[T]) NquadAll(uid string) []*api.NQuad {
+	return []*api.NQuad{deleteNodeNquad(uid)}
+}
+
+// nodeNquad 将结构体的字段转换为节点 uid 的N-Quad，匿名结构体展开到同一节点
+func nodeNquad(name string, fields map[string]Pred, uid string, val reflect.Value, blanks *BlankNodes) ([]*api.NQuad, error) {
 	var (
 		r   []*api.NQuad
-		val = reflect.ValueOf(data)
 		typ = val.Type()
 	)
-	if uid == "" {
-		return nil, errors.New("empty uid value")
-	}
 	for i := 0; i < val.NumField(); i++ {
 		subType := typ.Field(i)
 		subVal := val.Field(i)
-		subDbTag := subType.Tag.Get("db")
+		subDbTag := dbTag(subType)
 		// 跳过UID的值解析
 		if subType.Name == Uid {
 			continue
 		}
-		// 跳过反向边
-		if strings.HasPrefix(subDbTag, "~") {
+		// 跳过反向边、忽略字段和边属性
+		if strings.HasPrefix(subDbTag, "~") || subDbTag == "-" || strings.Contains(subDbTag, "|") {
 			continue
 		}
 		// 跳过空值
@@ -92,44 +122,34 @@ func (t Type[T]) Nquad(uid string, data any) ([]*api.NQuad, error) {
 		}
 		// 如果是匿名结构体，则递归解析结构体到同UID
 		if subType.Anonymous && subVal.Kind() == reflect.Struct {
-			anoNquads, err := t.Nquad(uid, subVal.Interface())
+			anoNquads, err := nodeNquad(name, fields, uid, subVal, blanks)
 			if err != nil {
 				return nil, err
 			}
 			r = append(r, anoNquads...)
 			continue
 		}
-		// 解析结构体单字段到dgraph nquad
-		nquadList, e := t.fieldNquad(
-			uid,
-			t.Fields[subType.Name],
-			subVal.Interface(),
-		)
+		// 解析结构体单字段到dgraph nquad，跳过没有对应谓词的字段(如嵌套结构体中没有 db 标签的字段)
+		pred, ok := fields[subType.Name]
+		if !ok {
+			continue
+		}
+		nquadList, e := fieldNquad(uid, pred, subVal, blanks)
 		if e != nil {
-			return nil, e
+			return nil, &ValidationError{Type: name, Field: subType.Name, Pred: pred.Name, Err: e}
 		}
 		r = append(r, nquadList...)
 	}
 	return r, nil
 }
 
-func (t Type[T]) NquadAll(uid string) []*api.NQuad {
-	return []*api.NQuad{{Subject: uid,
-		Predicate:   StarAll,
-		ObjectValue: &api.Value{Val: &api.Value_DefaultVal{DefaultVal: StarAll}}},
-	}
-}
-
-func (t Type[T]) fieldNquad(uid string, pred Pred, data any) ([]*api.NQuad, error) {
-	var (
-		r   []*api.NQuad
-		val = reflect.ValueOf(data)
-		typ = val.Type()
-	)
+// fieldNquad 将字段值转换为N-Quad，切片逐个元素转换
+func fieldNquad(uid string, pred Pred, val reflect.Value, blanks *BlankNodes) ([]*api.NQuad, error) {
+	var r []*api.NQuad
 	// 如果是切片类型的递归计算
-	if typ.Kind() == reflect.Slice {
+	if val.Kind() == reflect.Slice {
 		for i := 0; i < val.Len(); i++ {
-			sub, err := t.fieldNquad(uid, pred, val.Index(i).Interface())
+			sub, err := fieldNquad(uid, pred, val.Index(i), blanks)
 			if err != nil {
 				return nil, err
 			}
@@ -137,29 +157,65 @@ func (t Type[T]) fieldNquad(uid string, pred Pred, data any) ([]*api.NQuad, erro
 		}
 		return r, nil
 	}
-	// 解析 api.Value 值
 	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil, nil
+		}
 		val = val.Elem()
 	}
-	apival, objid, err := pred.Type.Value(data)
-	if err != nil {
-		return nil, fmt.Errorf("field=%s, err=%s", pred.Name, err)
+	if pred.Type == TypeUid && val.Kind() == reflect.Struct {
+		return edgeNquad(uid, pred, val, blanks)
 	}
-	nquad := &api.NQuad{Subject: uid, Predicate: pred.Name, ObjectId: objid, ObjectValue: apival}
-	// 如果值是Uid类型，则解析边属性
-	if pred.Type == TypeUid {
-		for k, facet := range pred.Facets {
-			facetVal := val.FieldByName(k)
-			if !facetVal.IsValid() || facetVal.IsZero() {
-				continue
-			}
-			var f api.Facet
-			f, err = facet.Facet(facetVal.Interface())
+	// 多语言值按语言标签排序后逐个写入，空字符串的 key 为不带语言标签的值
+	if val.Kind() == reflect.Map {
+		keys := val.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			apival, _, err := pred.Type.Value(val.MapIndex(key).String())
 			if err != nil {
 				return nil, err
 			}
-			nquad.Facets = append(nquad.Facets, &f)
+			r = append(r, &api.NQuad{Subject: uid, Predicate: pred.Name, ObjectValue: apival, Lang: key.String()})
 		}
+		return r, nil
+	}
+	// 解析 api.Value 值
+	apival, objid, err := pred.Type.Value(val.Interface())
+	if err != nil {
+		return nil, err
+	}
+	nquad := &api.NQuad{Subject: uid, Predicate: pred.Name, ObjectId: objid, ObjectValue: apival}
+	if apival != nil {
+		nquad.Lang = pred.writeLang()
+	}
+	r = append(r, nquad)
+	return r, nil
+}
+
+// edgeNquad 生成指向嵌套结构体的边和边属性，结构体没有UID时先作为新节点转换
+func edgeNquad(uid string, pred Pred, val reflect.Value, blanks *BlankNodes) ([]*api.NQuad, error) {
+	var (
+		r     []*api.NQuad
+		objid = getUid(val.Interface())
+		err   error
+	)
+	if objid == "" {
+		if objid, r, err = blanks.node(val); err != nil {
+			return nil, err
+		}
+	}
+	nquad := &api.NQuad{Subject: uid, Predicate: pred.Name, ObjectId: objid}
+	for k, facet := range pred.Facets {
+		facetVal := val.FieldByName(k)
+		if !facetVal.IsValid() || facetVal.IsZero() {
+			continue
+		}
+		var f api.Facet
+		f, err = facet.Facet(facetVal.Interface())
+		if err != nil {
+			return nil, err
+		}
+		nquad.Facets = append(nquad.Facets, &f)
 	}
 	r = append(r, nquad)
 	return r, nil
@@ -169,23 +225,33 @@ func (t Type[T]) fieldNquad(uid string, pred Pred, data any) ([]*api.NQuad, erro
 func (t Type[T]) CheckData() error {
 	val := reflect.ValueOf(t.DataModel)
 	// 检查结构体中的字段是否与传入的字典匹配
-	typ := val.Type()
+	return t.checkFields(val.Type())
+}
+
+// checkFields 检查结构体字段，匿名结构体递归检查
+func (t Type[T]) checkFields(typ reflect.Type) error {
 	for i := 0; i < typ.NumField(); i++ {
 		fieldType := typ.Field(i)
 		if fieldType.Name == Uid {
 			continue
 		}
-		db := fieldType.Tag.Get(Db)
+		db := dbTag(fieldType)
+		if fieldType.Anonymous && db == "" && nodeType(fieldType.Type).Kind() == reflect.Struct {
+			if err := t.checkFields(nodeType(fieldType.Type)); err != nil {
+				return err
+			}
+			continue
+		}
 		// 忽略边
-		if strings.Contains(db, "|") || strings.HasPrefix(db, "~") {
+		if db == "-" || strings.Contains(db, "|") || strings.HasPrefix(db, "~") {
 			continue
 		}
 		v, ok := t.Fields[fieldType.Name]
 		if !ok {
-			return errors.New(fmt.Sprintf("type [%s] check failed,struct field %s not find in predicate map key", typ.Name(), typ.Field(i).Name))
+			return &SchemaMismatchError{Type: t.Name, Field: fieldType.Name, Expected: "a predicate in type definition", Actual: "none"}
 		}
 		if db != v.Name {
-			return errors.New(fmt.Sprintf("type [%s] check failed, predicate name %s does not match the struct db tag %s", typ.Name(), v.Name, db))
+			return &SchemaMismatchError{Type: t.Name, Field: fieldType.Name, Pred: v.Name, Expected: "db tag " + v.Name, Actual: "db tag " + db}
 		}
 		err := t.checkStructField(v, typ.Field(i))
 		if err != nil {
@@ -196,44 +262,16 @@ func (t Type[T]) CheckData() error {
 }
 
 func (t Type[T]) checkStructField(pred Pred, field reflect.StructField) error {
-	var (
-		typ     = field.Type
-		matched bool // 谓词类型是否与数据类型匹配
-		islist  bool // 谓词是否为列表
-	)
-	if typ.Kind() == reflect.Slice {
-		typ = typ.Elem()
-		islist = true
-	}
-	if typ.Kind() == reflect.Pointer {
-		typ = typ.Elem()
-	}
-	switch typ.Name() {
-	case "string":
-		matched = pred.Type == "string" || pred.Type == "password"
-	case "int", "int8", "int16", "int32", "int64":
-		matched = pred.Type == "int"
-	case "float32", "float64":
-		matched = pred.Type == "float"
-	case "bool":
-		matched = pred.Type == "bool"
-	case "time.Time":
-		matched = pred.Type == "datetime"
-	case "geom.T":
-		matched = pred.Type == "geo"
-	default:
-		if typ.Kind() == reflect.Pointer {
-			typ = typ.Elem()
-		}
-		if typ.Kind() == reflect.Struct {
-			matched = pred.Type == "uid"
-		}
-	}
+	inferred, islist, ok := inferPredType(field.Type)
+	// 谓词类型是否与数据类型匹配
+	matched := ok && pred.Type.compatible(inferred)
 	if islist != pred.List {
-		return errors.New(fmt.Sprintf("predicate %s declear its list=%t, but field %s is not a list", pred.Name, pred.List, field.Name))
+		return &SchemaMismatchError{Type: t.Name, Field: field.Name, Pred: pred.Name,
+			Expected: fmt.Sprintf("list=%t", pred.List), Actual: fmt.Sprintf("list=%t", islist)}
 	}
 	if !matched {
-		return errors.New(fmt.Sprintf("predicate type %s, is not match field data type %s", pred.Type, field.Type.Name()))
+		return &SchemaMismatchError{Type: t.Name, Field: field.Name, Pred: pred.Name,
+			Expected: "type " + string(pred.Type), Actual: "go type " + field.Type.String()}
 	}
 	return nil
 }
@@ -0,0 +1,305 @@
+package dgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"strings"
+)
+
+// Cond upsert变更的执行条件，比较查询中变量的结果数量，可以用 And、Or、Not 组合
+type Cond struct {
+	expr string
+	vars []string
+	eval func(lens map[string]int) bool
+	err  error
+}
+
+func lenCond(op, name string, n int, cmp func(l int) bool) Cond {
+	if !varPattern.MatchString(name) {
+		return Cond{err: fmt.Errorf("%s: invalid variable name %s", op, name)}
+	}
+	if n < 0 {
+		return Cond{err: fmt.Errorf("%s: negative length %d", op, n)}
+	}
+	return Cond{
+		expr: fmt.Sprintf("%s(len(%s), %d)", op, name, n),
+		vars: []string{name},
+		eval: func(lens map[string]int) bool { return cmp(lens[name]) },
+	}
+}
+
+// LenEq 变量 name 的结果数量等于 n
+func LenEq(name string, n int) Cond {
+	return lenCond("eq", name, n, func(l int) bool { return l == n })
+}
+
+// LenLt 变量 name 的结果数量小于 n
+func LenLt(name string, n int) Cond {
+	return lenCond("lt", name, n, func(l int) bool { return l < n })
+}
+
+// LenLe 变量 name 的结果数量小于等于 n
+func LenLe(name string, n int) Cond {
+	return lenCond("le", name, n, func(l int) bool { return l <= n })
+}
+
+// LenGt 变量 name 的结果数量大于 n
+func LenGt(name string, n int) Cond {
+	return lenCond("gt", name, n, func(l int) bool { return l > n })
+}
+
+// LenGe 变量 name 的结果数量大于等于 n
+func LenGe(name string, n int) Cond {
+	return lenCond("ge", name, n, func(l int) bool { return l >= n })
+}
+
+// Exists 变量 name 有结果，等同于 LenGt(name, 0)
+func Exists(name string) Cond {
+	return LenGt(name, 0)
+}
+
+// NotExists 变量 name 没有结果，等同于 LenEq(name, 0)
+func NotExists(name string) Cond {
+	return LenEq(name, 0)
+}
+
+// And 所有条件同时满足
+func (c Cond) And(others ...Cond) Cond {
+	return combineCond("AND", append([]Cond{c}, others...))
+}
+
+// Or 满足任意一个条件
+func (c Cond) Or(others ...Cond) Cond {
+	return combineCond("OR", append([]Cond{c}, others...))
+}
+
+// Not 条件取反
+func (c Cond) Not() Cond {
+	if c.err != nil || c.eval == nil {
+		return c
+	}
+	return Cond{
+		expr: fmt.Sprintf("NOT %s", c.expr),
+		vars: c.vars,
+		eval: func(lens map[string]int) bool { return !c.eval(lens) },
+	}
+}
+
+// String 返回 @if 中的条件表达式，条件不合法时返回空字符串
+func (c Cond) String() string {
+	if c.err != nil {
+		return ""
+	}
+	return c.expr
+}
+
+func combineCond(op string, conds []Cond) Cond {
+	var (
+		parts []string
+		vars  []string
+	)
+	for _, c := range conds {
+		if c.err != nil {
+			return c
+		}
+		if c.eval == nil {
+			return Cond{err: fmt.Errorf("%s: empty condition", strings.ToLower(op))}
+		}
+		parts = append(parts, c.expr)
+		vars = append(vars, c.vars...)
+	}
+	return Cond{
+		expr: fmt.Sprintf("(%s)", strings.Join(parts, " "+op+" ")),
+		vars: vars,
+		eval: func(lens map[string]int) bool {
+			for _, c := range conds {
+				if c.eval(lens) == (op == "OR") {
+					return op == "OR"
+				}
+			}
+			return op != "OR"
+		},
+	}
+}
+
+// UidVar 返回引用UID变量的节点 uid(name)，可作为变更中 N-Quad 的主语或宾语
+func UidVar(name string) string {
+	return fmt.Sprintf("uid(%s)", name)
+}
+
+// Upsert upsert块，由定义变量的查询和一个或多个变更组成
+// 变更中可以使用 UidVar 引用查询中的变量，带条件的变更只在条件满足时执行
+type Upsert struct {
+	query     *Query
+	mutations []*api.Mutation
+	conds     []*Cond
+	err       error
+}
+
+// UpsertResult upsert执行结果
+// Fired - 各个变更是否被执行，顺序与添加顺序一致
+// Response - 服务端返回值，Uids 为空白节点对应的新节点UID
+type UpsertResult struct {
+	Fired    []bool
+	Response *api.Response
+}
+
+// NewUpsert 创建upsert块，query 为空时只能添加无条件的变更
+func NewUpsert(query *Query) *Upsert {
+	return &Upsert{query: query}
+}
+
+// Mutate 添加无条件执行的变更
+func (u *Upsert) Mutate(mu *api.Mutation) *Upsert {
+	return u.add(nil, mu)
+}
+
+// MutateIf 添加条件 cond 满足时执行的变更
+func (u *Upsert) MutateIf(cond Cond, mu *api.Mutation) *Upsert {
+	if cond.err == nil && cond.eval == nil {
+		cond.err = errors.New("upsert: empty condition")
+	}
+	return u.add(&cond, mu)
+}
+
+func (u *Upsert) add(cond *Cond, mu *api.Mutation) *Upsert {
+	switch {
+	case u.err != nil:
+	case mu == nil:
+		u.err = errors.New("upsert: nil mutation")
+	case mu.Cond != "":
+		u.err = errors.New("upsert: mutation condition should be set by MutateIf")
+	case mu.CommitNow:
+		u.err = errors.New("upsert: mutation should not commit now")
+	case cond != nil && cond.err != nil:
+		u.err = cond.err
+	}
+	u.mutations = append(u.mutations, mu)
+	u.conds = append(u.conds, cond)
+	return u
+}
+
+// countBlock 统计变量结果数量的查询块名称，用于判断变更是否被执行
+func countBlock(name string) string {
+	return "upsert_len_" + name
+}
+
+// Request 生成upsert请求，查询或条件不合法时返回错误
+func (u *Upsert) Request() (*api.Request, error) {
+	req, _, err := u.request()
+	return req, err
+}
+
+// request 生成upsert请求，并在查询中追加统计条件变量数量的块，返回这些变量
+func (u *Upsert) request() (*api.Request, []string, error) {
+	if u.err != nil {
+		return nil, nil, u.err
+	}
+	if len(u.mutations) == 0 {
+		return nil, nil, errors.New("upsert: no mutation")
+	}
+	var (
+		vars []string
+		seen = make(map[string]bool)
+		req  = &api.Request{}
+	)
+	for i, mu := range u.mutations {
+		cond := u.conds[i]
+		if cond == nil {
+			req.Mutations = append(req.Mutations, mu)
+			continue
+		}
+		for _, v := range cond.vars {
+			if !seen[v] {
+				seen[v] = true
+				vars = append(vars, v)
+			}
+		}
+		m := *mu
+		m.Cond = fmt.Sprintf("@if(%s)", cond.expr)
+		req.Mutations = append(req.Mutations, &m)
+	}
+	if u.query == nil {
+		if len(vars) > 0 {
+			return nil, nil, errors.New("upsert: condition requires a query")
+		}
+		return req, nil, nil
+	}
+	q := NewQuery(u.query.blocks...)
+	for _, v := range vars {
+		q.Block(NewBlock(countBlock(v), Uids(v)).field("count(uid)"))
+	}
+	var err error
+	if req.Query, err = q.Build(); err != nil {
+		return nil, nil, err
+	}
+	return req, vars, nil
+}
+
+// Exec 在事务 txn 中执行upsert，不提交事务
+func (u *Upsert) Exec(ctx context.Context, txn *Txn) (*UpsertResult, error) {
+	req, vars, err := u.request()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := txn.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	lens, err := varLens(resp.Json, vars)
+	if err != nil {
+		return nil, err
+	}
+	r := &UpsertResult{Fired: make([]bool, len(u.mutations)), Response: resp}
+	for i, cond := range u.conds {
+		r.Fired[i] = cond == nil || cond.eval(lens)
+	}
+	return r, nil
+}
+
+// varLens 从统计块中读取变量的结果数量
+func varLens(data []byte, vars []string) (map[string]int, error) {
+	lens := make(map[string]int, len(vars))
+	if len(vars) == 0 {
+		return lens, nil
+	}
+	var blocks map[string]json.RawMessage
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return nil, err
+	}
+	for _, v := range vars {
+		raw, ok := blocks[countBlock(v)]
+		if !ok {
+			continue
+		}
+		var counts []struct {
+			Count *int `json:"count"`
+		}
+		if err := json.Unmarshal(raw, &counts); err != nil {
+			return nil, err
+		}
+		for _, c := range counts {
+			if c.Count != nil {
+				lens[v] = *c.Count
+			}
+		}
+	}
+	return lens, nil
+}
+
+// Upsert 在读写事务中执行upsert并提交，事务冲突时按重试策略重新执行
+func (d *Client) Upsert(ctx context.Context, u *Upsert, opts ...TxnOption) (*UpsertResult, error) {
+	var r *UpsertResult
+	err := d.RunInTxn(ctx, func(txn *Txn) error {
+		var err error
+		r, err = u.Exec(ctx, txn)
+		return err
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
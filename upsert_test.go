@@ -0,0 +1,55 @@
+package dgraph_test
+
+import (
+	"context"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+	"github.com/golang-common/dgraph"
+	"reflect"
+	"testing"
+)
+
+func TestUpsertFired(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	email := dgraph.Pred{SchemaPred: dgraph.SchemaPred{Name: "email", Type: dgraph.TypeString, Index: true, Tokens: []string{"exact"}, Upsert: true}}
+	if err := client.SetPred(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	upsert := func() *dgraph.Upsert {
+		q := dgraph.NewQuery(dgraph.NewVarBlock(dgraph.Eq(email, "a@example.com")).As("v"))
+		return dgraph.NewUpsert(q).
+			MutateIf(dgraph.NotExists("v"), &api.Mutation{SetNquads: []byte(`_:new <email> "a@example.com" .`)}).
+			MutateIf(dgraph.LenEq("v", 1), &api.Mutation{SetNquads: []byte(`uid(v) <visits> "1" .`)}).
+			MutateIf(dgraph.Exists("v").And(dgraph.LenGt("v", 1)), &api.Mutation{SetNquads: []byte(`uid(v) <dup> "true" .`)}).
+			Mutate(&api.Mutation{SetNquads: []byte(`_:log <event> "upsert" .`)})
+	}
+
+	r, err := client.Upsert(ctx, upsert())
+	if err != nil {
+		t.Fatalf("first Upsert: %v", err)
+	}
+	if want := []bool{true, false, false, true}; !reflect.DeepEqual(r.Fired, want) {
+		t.Errorf("first Upsert: got fired %v, want %v", r.Fired, want)
+	}
+	created := r.Response.Uids["new"]
+	if created == "" {
+		t.Errorf("first Upsert should create a node, got uids %v", r.Response.Uids)
+	}
+
+	if r, err = client.Upsert(ctx, upsert()); err != nil {
+		t.Fatalf("second Upsert: %v", err)
+	}
+	if want := []bool{false, true, false, true}; !reflect.DeepEqual(r.Fired, want) {
+		t.Errorf("second Upsert: got fired %v, want %v", r.Fired, want)
+	}
+	if _, ok := r.Response.Uids["new"]; ok {
+		t.Errorf("second Upsert should not create a node, got uids %v", r.Response.Uids)
+	}
+	resp, err := client.Txn(true).Query(ctx, `{ q(func: eq(email, "a@example.com")) { uid visits dup } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(resp.Json), `{"q":[{"uid":"`+created+`","visits":"1"}]}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}